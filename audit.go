@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const minRSABits = 3072
+
+const (
+	severityHigh   = "high"
+	severityMedium = "medium"
+)
+
+// Remediation actions an audit finding can offer.
+const (
+	remedyRotate      = "Rotate"
+	remedyPassphrase  = "Add Passphrase"
+	remedyPermissions = "Fix Permissions"
+	remedyManual      = "Replace Manually"
+)
+
+// auditFinding is one problem with a key. Label is the account a Rotate
+// remedy rotates.
+type auditFinding struct {
+	Severity string
+	Path     string
+	Issue    string
+	Remedy   string
+	Label    string
+	Hosts    []string
+}
+
+// auditKeys checks the keys in sshDir for weak algorithms, missing
+// passphrases, loose permissions and public keys shared by several Host
+// aliases.
+func auditKeys(sshDir, configFile string) ([]auditFinding, error) {
+	keys, err := scanKeyInventory(sshDir, configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	reg, err := loadKeyRegistry(sshDir)
+	if err != nil {
+		reg = keyRegistry{}
+	}
+
+	var findings []auditFinding
+	add := func(k inventoryKey, severity, issue, remedy string) {
+		f := auditFinding{Severity: severity, Path: k.Path, Issue: issue, Remedy: remedy, Hosts: k.Hosts}
+		if remedy == remedyRotate {
+			if f.Label = rotationLabel(sshDir, reg, k.Path); f.Label == "" {
+				f.Remedy = remedyManual
+			}
+		}
+		findings = append(findings, f)
+	}
+
+	byFingerprint := map[string][]inventoryKey{}
+	for _, k := range keys {
+		switch {
+		case k.Type == ssh.KeyAlgoDSA:
+			add(k, severityHigh, "DSA keys are deprecated and rejected by GitHub", remedyRotate)
+		case k.Type == ssh.KeyAlgoRSA && k.Bits < minRSABits:
+			add(k, severityMedium, fmt.Sprintf("RSA key is %d bits; use at least %d", k.Bits, minRSABits), remedyRotate)
+		}
+		if k.HasPrivate && !k.Encrypted {
+			add(k, severityMedium, "private key is not protected by a passphrase", remedyPassphrase)
+		}
+		if k.HasPrivate && runtime.GOOS != "windows" {
+			if info, err := os.Stat(k.Path); err == nil && info.Mode().Perm()&0o077 != 0 {
+				add(k, severityHigh, fmt.Sprintf("private key permissions are %04o; expected 0600", info.Mode().Perm()), remedyPermissions)
+			}
+		}
+		if k.Fingerprint != "" {
+			byFingerprint[k.Fingerprint] = append(byFingerprint[k.Fingerprint], k)
+		}
+	}
+
+	// Reuse is counted per alias, so a Host block and a Match rule for the
+	// same alias sharing a key are fine. Blocks naming no alias, such as the
+	// global section or a wildcard, count on their own.
+	for _, group := range byFingerprint {
+		var hosts, users []string
+		for _, k := range group {
+			hosts = append(hosts, k.Hosts...)
+			for _, name := range k.Hosts {
+				aliases := refAliases([]string{name})
+				if len(aliases) == 0 {
+					aliases = []string{name}
+				}
+				for _, a := range aliases {
+					if !containsFold(users, a) {
+						users = append(users, a)
+					}
+				}
+			}
+		}
+		if len(users) < 2 {
+			continue
+		}
+		sort.Strings(hosts)
+		sort.Strings(users)
+		k := group[0]
+		k.Hosts = hosts
+		add(k, severityMedium, "same public key is used by Host entries "+strings.Join(users, ", "), remedyRotate)
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].Severity != findings[j].Severity {
+			return findings[i].Severity == severityHigh
+		}
+		return findings[i].Path < findings[j].Path
+	})
+	return findings, nil
+}
+
+// refAliases returns the host aliases named by blocks listed by
+// configIdentityFiles, without duplicates.
+func refAliases(names []string) []string {
+	var aliases []string
+	for _, name := range names {
+		h := refHeader(name)
+		if h == nil {
+			continue
+		}
+		for _, a := range headerAliases(h) {
+			if !containsFold(aliases, a) {
+				aliases = append(aliases, a)
+			}
+		}
+	}
+	return aliases
+}
+
+// rotationLabel returns the account label whose rotation replaces keyPath:
+// one the key registry records for it or the one its file name encodes. It
+// returns "" when no label leads back to keyPath, as for DSA keys or keys
+// the app did not name.
+func rotationLabel(sshDir string, reg keyRegistry, keyPath string) string {
+	var labels []string
+	for label, rec := range reg {
+		if filepath.Clean(rec.KeyPath) == filepath.Clean(keyPath) {
+			labels = append(labels, label)
+		}
+	}
+	sort.Strings(labels)
+	if label := guessKeyLabel(keyPath); label != "" {
+		labels = append(labels, label)
+	}
+	for _, label := range labels {
+		if path, ok := findKeyBasePath(sshDir, label); ok && filepath.Clean(path) == filepath.Clean(keyPath) {
+			return label
+		}
+	}
+	return ""
+}
+
+// fixKeyPermissions restricts a private key to its owner.
+func fixKeyPermissions(keyPath string) error {
+	return os.Chmod(keyPath, 0o600)
+}
+
+// guessKeyLabel recovers the account label from a key path named by the
+// current file name template or the default <prefix>_<label> scheme, or
+// returns "" if it follows neither.
+func guessKeyLabel(keyPath string) string {
+	if label := keyFileLabel(keyPath); label != "" {
+		return label
+	}
+	base := filepath.Base(keyPath)
+	for _, prefix := range keyFilePrefixes {
+		if label, ok := strings.CutPrefix(base, prefix+"_"); ok && validateLabel(label) == nil {
+			return label
+		}
+	}
+	return ""
+}
+
+// auditReportCSV renders findings as CSV for export.
+func auditReportCSV(findings []auditFinding) ([]byte, error) {
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	if err := cw.Write([]string{"Severity", "Key", "Issue", "Remediation", "Hosts"}); err != nil {
+		return nil, err
+	}
+	for _, f := range findings {
+		if err := cw.Write([]string{f.Severity, f.Path, f.Issue, f.Remedy, strings.Join(f.Hosts, "; ")}); err != nil {
+			return nil, err
+		}
+	}
+	cw.Flush()
+	return buf.Bytes(), cw.Error()
+}
+
+func auditSummary(findings []auditFinding) string {
+	high := 0
+	for _, f := range findings {
+		if f.Severity == severityHigh {
+			high++
+		}
+	}
+	return strconv.Itoa(len(findings)) + " finding(s), " + strconv.Itoa(high) + " high severity"
+}
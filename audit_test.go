@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRotationLabel(t *testing.T) {
+	useNaming(t, "gh_{label}_{algo}")
+	sshDir := t.TempDir()
+	for _, name := range []string{"gh_work_ed25519", "id_rsa_legacy", "id_rsa", "id_dsa_old", "custom_key", "gh_moved_rsa"} {
+		if err := os.WriteFile(filepath.Join(sshDir, name), []byte("x"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reg := keyRegistry{}
+	reg.recordCreated("tracked", filepath.Join(sshDir, "custom_key"), time.Now())
+	reg.recordCreated("dsa", filepath.Join(sshDir, "id_dsa_old"), time.Now())
+
+	tests := []struct {
+		name, want string
+	}{
+		{"gh_work_ed25519", "work"},
+		{"id_rsa_legacy", "legacy"},
+		{"id_rsa", ""},
+		// Tracked, but the label's lookup does not find this file.
+		{"custom_key", ""},
+		{"id_dsa_old", ""},
+		{"gh_moved_rsa", "moved"},
+	}
+	for _, tt := range tests {
+		if got := rotationLabel(sshDir, reg, filepath.Join(sshDir, tt.name)); got != tt.want {
+			t.Errorf("rotationLabel(%s) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAuditOffersRotateOnlyForResolvableKeys(t *testing.T) {
+	sshDir := t.TempDir()
+	configFile := filepath.Join(sshDir, "config")
+	key, err := newPrivateKey(keyAlgorithm{Type: "rsa", Bits: 2048})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"id_rsa", "id_rsa_work"} {
+		if err := writeKeyPair(filepath.Join(sshDir, name), key, "", "passphrase", 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	findings, err := auditKeys(sshDir, configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]struct{ remedy, label string }{
+		"id_rsa":      {remedyManual, ""},
+		"id_rsa_work": {remedyRotate, "work"},
+	}
+	seen := 0
+	for _, f := range findings {
+		w, ok := want[filepath.Base(f.Path)]
+		if !ok || f.Remedy == remedyPassphrase || f.Remedy == remedyPermissions {
+			continue
+		}
+		seen++
+		if f.Remedy != w.remedy || f.Label != w.label {
+			t.Errorf("%s: remedy %q label %q, want %q %q", filepath.Base(f.Path), f.Remedy, f.Label, w.remedy, w.label)
+		}
+	}
+	if seen != len(want) {
+		t.Errorf("got %d weak key findings, want %d: %+v", seen, len(want), findings)
+	}
+}
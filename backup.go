@@ -0,0 +1,503 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// backupMagic starts every backup file. It is followed by a JSON header line
+// holding the KDF parameters and nonce, then the AES-256-GCM sealed bundle.
+// The magic and header are authenticated as additional data.
+const backupMagic = "github-ssh-manager backup v1\n"
+
+const backupFileExt = ".sshbackup"
+
+type backupHeader struct {
+	KDF     string `json:"kdf"`
+	Salt    []byte `json:"salt"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+	Nonce   []byte `json:"nonce"`
+}
+
+// Argon2 limits for opening a backup. The header is read before anything
+// is authenticated, so its parameters must not be able to stall the app.
+const (
+	backupMaxTime   = 16
+	backupMaxMemory = 1 << 20
+)
+
+type backupBundle struct {
+	Created    time.Time       `json:"created"`
+	Keys       []backupKey     `json:"keys"`
+	Hosts      []backupHost    `json:"hosts"`
+	KnownHosts []string        `json:"known_hosts"`
+	KeyRecords keyRegistry     `json:"key_records,omitempty"`
+	Settings   *backupSettings `json:"settings,omitempty"`
+}
+
+// backupSettings holds the app preferences saved with a backup.
+type backupSettings struct {
+	Naming         keyNaming `json:"naming"`
+	IncludeMode    bool      `json:"include_mode"`
+	PreviewChanges bool      `json:"preview_changes"`
+}
+
+// backupKey is a key pair stored by file name only, so it can be restored
+// into an SSH directory at a different path.
+type backupKey struct {
+	Name    string `json:"name"`
+	Private []byte `json:"private,omitempty"`
+	Public  []byte `json:"public,omitempty"`
+}
+
+// backupHost is a Host block from the SSH config. Key names the backupKey
+// its IdentityFile pointed to.
+type backupHost struct {
+	Alias string `json:"alias"`
+	Key   string `json:"key"`
+	Block string `json:"block"`
+}
+
+// collectBackup gathers keyPaths with their key age records, the Host
+// blocks whose IdentityFile names one of them, the GitHub lines of
+// known_hosts and settings.
+func collectBackup(sshDir, configFile string, keyPaths []string, settings backupSettings) (*backupBundle, error) {
+	if len(keyPaths) == 0 {
+		return nil, errors.New("select at least one key to back up")
+	}
+	bundle := &backupBundle{Created: time.Now().UTC(), Settings: &settings}
+
+	refs := configTreeIdentityFiles(configFile, filepath.Dir(sshDir))
+	reg, err := loadKeyRegistry(sshDir)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	for _, keyPath := range keyPaths {
+		for label, rec := range reg {
+			if filepath.Clean(rec.KeyPath) == filepath.Clean(keyPath) {
+				if bundle.KeyRecords == nil {
+					bundle.KeyRecords = keyRegistry{}
+				}
+				bundle.KeyRecords[label] = rec
+			}
+		}
+		key := backupKey{Name: filepath.Base(keyPath)}
+		if key.Private, err = os.ReadFile(keyPath); err != nil {
+			return nil, fmt.Errorf("read %s: %w", keyPath, err)
+		}
+		if pub, err := os.ReadFile(keyPath + ".pub"); err == nil {
+			key.Public = pub
+		}
+		bundle.Keys = append(bundle.Keys, key)
+
+		for _, name := range refs[filepath.Clean(keyPath)] {
+			h := refHeader(name)
+			if h == nil || !h.is("host") {
+				continue
+			}
+			aliases := headerAliases(h)
+			if len(aliases) == 0 || seen[strings.ToLower(aliases[0])] {
+				continue
+			}
+			alias := aliases[0]
+			file, ok := findHostFile(configFile, alias)
+			if !ok {
+				continue
+			}
+			config, err := os.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			block, ok := hostBlockText(config, alias)
+			if !ok {
+				continue
+			}
+			seen[strings.ToLower(alias)] = true
+			bundle.Hosts = append(bundle.Hosts, backupHost{Alias: alias, Key: key.Name, Block: block})
+		}
+	}
+
+	bundle.KnownHosts, err = githubKnownHosts(filepath.Join(sshDir, "known_hosts"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return bundle, nil
+}
+
+// githubKnownHosts returns the known_hosts lines whose host field mentions
+// github.com. Hashed entries cannot be matched and are skipped.
+func githubKnownHosts(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.Contains(strings.Fields(line)[0], "github.com") {
+			lines = append(lines, line)
+		}
+	}
+	return lines, s.Err()
+}
+
+func sealBackup(bundle *backupBundle, passphrase string) ([]byte, error) {
+	payload, err := json.Marshal(bundle)
+	if err != nil {
+		return nil, err
+	}
+	hdr := backupHeader{KDF: "argon2id", Salt: make([]byte, 16), Time: 3, Memory: 64 * 1024, Threads: 4}
+	if _, err := rand.Read(hdr.Salt); err != nil {
+		return nil, err
+	}
+	aead, err := backupAEAD(hdr, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	hdr.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(hdr.Nonce); err != nil {
+		return nil, err
+	}
+	hdrLine, err := json.Marshal(hdr)
+	if err != nil {
+		return nil, err
+	}
+
+	out := append([]byte(backupMagic), hdrLine...)
+	out = append(out, '\n')
+	return aead.Seal(bytes.Clone(out), hdr.Nonce, payload, out), nil
+}
+
+func openBackup(data []byte, passphrase string) (*backupBundle, error) {
+	if !bytes.HasPrefix(data, []byte(backupMagic)) {
+		return nil, errors.New("not a github-ssh-manager backup file")
+	}
+	n := bytes.IndexByte(data[len(backupMagic):], '\n')
+	if n < 0 {
+		return nil, errors.New("backup header is truncated")
+	}
+	split := len(backupMagic) + n + 1
+
+	var hdr backupHeader
+	if err := json.Unmarshal(data[len(backupMagic):split-1], &hdr); err != nil {
+		return nil, fmt.Errorf("invalid backup header: %w", err)
+	}
+	if hdr.KDF != "argon2id" {
+		return nil, fmt.Errorf("unsupported backup KDF %q", hdr.KDF)
+	}
+	aead, err := backupAEAD(hdr, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if len(hdr.Nonce) != aead.NonceSize() {
+		return nil, errors.New("invalid backup nonce")
+	}
+	payload, err := aead.Open(nil, hdr.Nonce, data[split:], data[:split])
+	if err != nil {
+		return nil, errors.New("wrong passphrase or corrupted backup")
+	}
+
+	var bundle backupBundle
+	if err := json.Unmarshal(payload, &bundle); err != nil {
+		return nil, fmt.Errorf("invalid backup contents: %w", err)
+	}
+	for _, k := range bundle.Keys {
+		if !isPlainFileName(k.Name) {
+			return nil, fmt.Errorf("backup contains an invalid key name %q", k.Name)
+		}
+	}
+	return &bundle, nil
+}
+
+func backupAEAD(hdr backupHeader, passphrase string) (cipher.AEAD, error) {
+	if hdr.Time < 1 || hdr.Time > backupMaxTime || hdr.Threads < 1 ||
+		hdr.Memory < 8*uint32(hdr.Threads) || hdr.Memory > backupMaxMemory {
+		return nil, errors.New("invalid backup KDF parameters")
+	}
+	key := argon2.IDKey([]byte(passphrase), hdr.Salt, hdr.Time, hdr.Memory, hdr.Threads, 32)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func isPlainFileName(name string) bool {
+	return name != "" && name != "." && name != ".." && filepath.Base(name) == name && !strings.ContainsAny(name, `/\`)
+}
+
+// restoreItem is one key pair or Host entry from a backup. Conflict is set
+// when something different already exists at the target; such items are
+// only written when Overwrite is set. Unchanged items are marked Same and
+// skipped.
+type restoreItem struct {
+	Kind      string
+	Name      string
+	Conflict  bool
+	Same      bool
+	Overwrite bool
+}
+
+type restorePlan struct {
+	bundle     *backupBundle
+	Items      []restoreItem
+	KnownHosts []string
+}
+
+func planRestore(bundle *backupBundle, sshDir, configFile string) (*restorePlan, error) {
+	plan := &restorePlan{bundle: bundle}
+	for _, k := range bundle.Keys {
+		item := restoreItem{Kind: "key", Name: k.Name}
+		path := filepath.Join(sshDir, k.Name)
+		priv, privErr := os.ReadFile(path)
+		pub, pubErr := os.ReadFile(path + ".pub")
+		switch {
+		case os.IsNotExist(privErr) && os.IsNotExist(pubErr):
+		case bytes.Equal(priv, k.Private) && (k.Public == nil || bytes.Equal(pub, k.Public)):
+			item.Same = true
+		default:
+			item.Conflict = true
+		}
+		plan.Items = append(plan.Items, item)
+	}
+
+	for _, h := range bundle.Hosts {
+		item := restoreItem{Kind: "host", Name: h.Alias}
+		if file, ok := findHostFile(configFile, h.Alias); ok {
+			config, err := os.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			if existing, _ := hostBlockText(config, h.Alias); sameHostBlock(existing, restoredHostBlock(h, sshDir)) {
+				item.Same = true
+			} else {
+				item.Conflict = true
+			}
+		}
+		plan.Items = append(plan.Items, item)
+	}
+
+	known, err := githubKnownHosts(filepath.Join(sshDir, "known_hosts"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	present := map[string]bool{}
+	for _, line := range known {
+		present[line] = true
+	}
+	for _, line := range bundle.KnownHosts {
+		if !present[line] {
+			plan.KnownHosts = append(plan.KnownHosts, line)
+		}
+	}
+	return plan, nil
+}
+
+// restoredHostBlock returns h.Block with its IdentityFile pointed at the
+// restored key inside sshDir.
+func restoredHostBlock(h backupHost, sshDir string) string {
+	block := h.Block
+	if !strings.HasSuffix(block, "\n") {
+		block += "\n"
+	}
+	if h.Key == "" {
+		return block
+	}
+	updated, err := setHostIdentityFile([]byte(block), h.Alias, filepath.Join(sshDir, h.Key))
+	if err != nil {
+		return block
+	}
+	return string(updated)
+}
+
+// sameHostBlock reports whether two Host blocks have the same header and
+// options, ignoring layout, quoting and line endings.
+func sameHostBlock(a, b string) bool {
+	ca, cb := parseSSHConfig([]byte(a)), parseSSHConfig([]byte(b))
+	if len(ca.Blocks) != 1 || len(cb.Blocks) != 1 {
+		return false
+	}
+	ba, bb := ca.Blocks[0], cb.Blocks[0]
+	return strings.EqualFold(renderConfigOption(ba.Header.Keyword, ba.Header.Args), renderConfigOption(bb.Header.Keyword, bb.Header.Args)) &&
+		repeatsBlock(ba, bb) && repeatsBlock(bb, ba)
+}
+
+// restoredHostEntry splits the restored Host block of h into the header
+// and options that sshConfig.appendBlock takes.
+func restoredHostEntry(h backupHost, sshDir string) (string, [][2]string, error) {
+	cfg := parseSSHConfig([]byte(restoredHostBlock(h, sshDir)))
+	if len(cfg.Blocks) != 1 || !cfg.Blocks[0].Header.is("host") {
+		return "", nil, fmt.Errorf("backup entry for %s is not a single Host block", h.Alias)
+	}
+	b := cfg.Blocks[0]
+	var options [][2]string
+	for _, l := range b.Lines {
+		if l.Keyword != "" {
+			options = append(options, [2]string{l.Keyword, renderConfigArgs(l.Args)})
+		}
+	}
+	return renderConfigOption(b.Header.Keyword, b.Header.Args), options, nil
+}
+
+// applyRestore writes the planned items. Conflicting key pairs that are
+// overwritten are archived first, like rotateKey does with replaced keys.
+// Host entries are added to targetFile; an overwritten entry is first
+// removed from whichever file under configFile defines it.
+func applyRestore(plan *restorePlan, sshDir, configFile, targetFile string, progress func(string)) error {
+	keys := map[string]backupKey{}
+	for _, k := range plan.bundle.Keys {
+		keys[k.Name] = k
+	}
+	hosts := map[string]backupHost{}
+	for _, h := range plan.bundle.Hosts {
+		hosts[h.Alias] = h
+	}
+
+	if err := ensureSSHDirectory(sshDir); err != nil {
+		return err
+	}
+	if err := ensureConfigFile(configFile); err != nil {
+		return err
+	}
+	if targetFile != configFile {
+		if err := os.MkdirAll(filepath.Dir(targetFile), 0o700); err != nil {
+			return err
+		}
+		if err := ensureConfigFile(targetFile); err != nil {
+			return err
+		}
+		if err := ensureInclude(configFile, targetFile); err != nil {
+			return err
+		}
+	}
+
+	for _, item := range plan.Items {
+		if item.Same || (item.Conflict && !item.Overwrite) {
+			continue
+		}
+		switch item.Kind {
+		case "key":
+			k := keys[item.Name]
+			path := filepath.Join(sshDir, k.Name)
+			if item.Conflict {
+				dir, err := archiveKeyFiles(sshDir, path)
+				if err != nil {
+					return fmt.Errorf("archive existing %s: %w", k.Name, err)
+				}
+				progress("Existing " + k.Name + " archived to " + dir)
+			}
+			if err := writeFileAtomic(path, k.Private, 0o600); err != nil {
+				return err
+			}
+			if k.Public != nil {
+				if err := writeFileAtomic(path+".pub", k.Public, 0o644); err != nil {
+					return err
+				}
+			}
+			progress("Restored key " + path)
+		case "host":
+			h := hosts[item.Name]
+			if file, ok := findHostFile(configFile, h.Alias); ok && item.Conflict {
+				backup, _, err := removeHostFromConfig(sshDir, file, h.Alias)
+				if err != nil {
+					return err
+				}
+				progress("Existing Host " + h.Alias + " removed (backup: " + backup + ")")
+			}
+			if hasHostAlias(configFile, h.Alias) || hasHostAlias(targetFile, h.Alias) {
+				progress("Host " + h.Alias + " is already defined; the backed up entry was not added")
+				continue
+			}
+			header, options, err := restoredHostEntry(h, sshDir)
+			if err != nil {
+				return err
+			}
+			config, err := readFileIfExists(targetFile)
+			if err != nil {
+				return err
+			}
+			cfg := parseSSHConfig(config)
+			cfg.appendBlock(header, options)
+			if err := writeSSHFile(sshDir, targetFile, cfg.Bytes(), 0o600); err != nil {
+				return fmt.Errorf("update SSH config: %w", err)
+			}
+			progress("Restored Host " + h.Alias)
+		}
+	}
+
+	if err := restoreKeyRecords(plan, sshDir, progress); err != nil {
+		return fmt.Errorf("update key age records: %w", err)
+	}
+
+	if len(plan.KnownHosts) > 0 {
+		if err := appendKnownHosts(sshDir, plan.KnownHosts); err != nil {
+			return fmt.Errorf("update known_hosts: %w", err)
+		}
+		progress(fmt.Sprintf("Added %d GitHub host key(s) to known_hosts", len(plan.KnownHosts)))
+	}
+	return nil
+}
+
+// restoreKeyRecords adds the backed up age records of the key pairs that
+// were restored, or are already present unchanged, pointing them at sshDir.
+// A label that is already tracked keeps its record unless its key was
+// overwritten by the restore.
+func restoreKeyRecords(plan *restorePlan, sshDir string, progress func(string)) error {
+	if len(plan.bundle.KeyRecords) == 0 {
+		return nil
+	}
+	restored := map[string]bool{}
+	for _, item := range plan.Items {
+		if item.Kind == "key" && !(item.Conflict && !item.Overwrite) {
+			restored[item.Name] = !item.Same
+		}
+	}
+	reg, err := loadKeyRegistry(sshDir)
+	if err != nil {
+		return err
+	}
+	n := 0
+	for label, rec := range plan.bundle.KeyRecords {
+		name := filepath.Base(rec.KeyPath)
+		written, ok := restored[name]
+		if !ok || !isPlainFileName(name) {
+			continue
+		}
+		path := filepath.Join(sshDir, name)
+		if old, exists := reg[label]; exists && (!written || filepath.Clean(old.KeyPath) != path) {
+			continue
+		}
+		r := *rec
+		r.KeyPath = path
+		reg[label] = &r
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+	if err := reg.save(sshDir); err != nil {
+		return err
+	}
+	progress(fmt.Sprintf("Restored age records for %d key(s)", n))
+	return nil
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// backupFixture creates an SSH directory with one tracked key, a Host entry
+// using it and known_hosts lines, and returns the directory and key path.
+func backupFixture(t *testing.T) (string, string) {
+	t.Helper()
+	sshDir := filepath.Join(t.TempDir(), ".ssh")
+	if err := os.MkdirAll(sshDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(sshDir, "id_ed25519_work")
+	if err := generateKeyPairBuiltin(keyPath, "work@github", keyOptions{Algorithm: keyAlgorithms[0]}); err != nil {
+		t.Fatal(err)
+	}
+	config := "Host *\n  AddKeysToAgent yes\n\nMatch originalhost work exec \"on-vpn\"\n  IdentityFile " + quoteConfigArg(keyPath) + "\n\n" +
+		"Host work\n  HostName github.com\n  User git\n  IdentityFile " + quoteConfigArg(keyPath) + "\n"
+	files := map[string]string{
+		"config":      config,
+		"known_hosts": "github.com ssh-ed25519 AAAA\nexample.org ssh-rsa BBBB\n",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(sshDir, name), []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reg := keyRegistry{}
+	reg.recordCreated("work", keyPath, time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC))
+	reg["work"].MaxAgeDays = 90
+	if err := reg.save(sshDir); err != nil {
+		t.Fatal(err)
+	}
+	return sshDir, keyPath
+}
+
+func sealedFixture(t *testing.T, passphrase string) ([]byte, string) {
+	t.Helper()
+	sshDir, keyPath := backupFixture(t)
+	settings := backupSettings{Naming: keyNaming{Comment: "{label}", FileName: "gh_{label}", Title: "{label}"}, IncludeMode: true}
+	bundle, err := collectBackup(sshDir, filepath.Join(sshDir, "config"), []string{keyPath}, settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := sealBackup(bundle, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data, keyPath
+}
+
+func TestBackupRestoreRoundTrip(t *testing.T) {
+	data, keyPath := sealedFixture(t, "correct horse")
+	bundle, err := openBackup(data, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bundle.Keys) != 1 || len(bundle.Hosts) != 1 || bundle.Hosts[0].Alias != "work" {
+		t.Fatalf("unexpected bundle contents: %d keys, hosts %+v", len(bundle.Keys), bundle.Hosts)
+	}
+	if want := []string{"github.com ssh-ed25519 AAAA"}; strings.Join(bundle.KnownHosts, "\n") != want[0] {
+		t.Errorf("known_hosts = %q, want %q", bundle.KnownHosts, want)
+	}
+	if bundle.Settings == nil || bundle.Settings.Naming.FileName != "gh_{label}" || !bundle.Settings.IncludeMode {
+		t.Errorf("settings = %+v", bundle.Settings)
+	}
+
+	sshDir := filepath.Join(t.TempDir(), ".ssh")
+	configFile := filepath.Join(sshDir, "config")
+	plan, err := planRestore(bundle, sshDir, configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := applyRestore(plan, sshDir, configFile, configFile, func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	restoredKey := filepath.Join(sshDir, "id_ed25519_work")
+	for _, suffix := range []string{"", ".pub"} {
+		want, _ := os.ReadFile(keyPath + suffix)
+		got, err := os.ReadFile(restoredKey + suffix)
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("restored %s differs (%v)", filepath.Base(restoredKey+suffix), err)
+		}
+	}
+	config, _ := os.ReadFile(configFile)
+	cfg := parseSSHConfig(config)
+	host := cfg.findHost("work")
+	if host == nil {
+		t.Fatalf("Host work not restored:\n%s", config)
+	}
+	if got := host.options()["identityfile"]; got != restoredKey {
+		t.Errorf("IdentityFile = %q, want %q", got, restoredKey)
+	}
+	known, _ := os.ReadFile(filepath.Join(sshDir, "known_hosts"))
+	if string(known) != "github.com ssh-ed25519 AAAA\n" {
+		t.Errorf("known_hosts = %q", known)
+	}
+	reg, err := loadKeyRegistry(sshDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec := reg["work"]; rec == nil || rec.KeyPath != restoredKey || rec.MaxAgeDays != 90 || rec.Created.Year() != 2026 {
+		t.Errorf("key record = %+v", rec)
+	}
+
+	plan, err = planRestore(bundle, sshDir, configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range plan.Items {
+		if !item.Same {
+			t.Errorf("second restore: %s %s is not unchanged", item.Kind, item.Name)
+		}
+	}
+	if len(plan.KnownHosts) != 0 {
+		t.Errorf("second restore adds known_hosts lines %q", plan.KnownHosts)
+	}
+}
+
+func TestOpenBackupRejects(t *testing.T) {
+	data, _ := sealedFixture(t, "correct horse")
+	header := func(edit func(h *backupHeader)) []byte {
+		rest := data[len(backupMagic):]
+		n := bytes.IndexByte(rest, '\n')
+		var h backupHeader
+		if err := json.Unmarshal(rest[:n], &h); err != nil {
+			t.Fatal(err)
+		}
+		edit(&h)
+		line, _ := json.Marshal(h)
+		out := append([]byte(backupMagic), line...)
+		return append(out, rest[n:]...)
+	}
+	flip := func(i int) []byte {
+		out := bytes.Clone(data)
+		out[i] ^= 1
+		return out
+	}
+
+	tests := []struct {
+		name       string
+		data       []byte
+		passphrase string
+		want       string
+	}{
+		{"wrong passphrase", data, "wrong", "wrong passphrase"},
+		{"tampered ciphertext", flip(len(data) - 20), "correct horse", "wrong passphrase"},
+		{"tampered tag", flip(len(data) - 1), "correct horse", "wrong passphrase"},
+		{"tampered salt", header(func(h *backupHeader) { h.Salt[0] ^= 1 }), "correct horse", "wrong passphrase"},
+		{"not a backup", []byte("hello"), "correct horse", "not a github-ssh-manager backup"},
+		{"truncated header", []byte(backupMagic + "{"), "correct horse", "truncated"},
+		{"huge time", header(func(h *backupHeader) { h.Time = 1 << 31 }), "correct horse", "KDF parameters"},
+		{"zero time", header(func(h *backupHeader) { h.Time = 0 }), "correct horse", "KDF parameters"},
+		{"zero threads", header(func(h *backupHeader) { h.Threads = 0 }), "correct horse", "KDF parameters"},
+		{"huge memory", header(func(h *backupHeader) { h.Memory = 1 << 31 }), "correct horse", "KDF parameters"},
+		{"memory below 8 KiB per thread", header(func(h *backupHeader) { h.Memory = 8 }), "correct horse", "KDF parameters"},
+		{"unknown KDF", header(func(h *backupHeader) { h.KDF = "scrypt" }), "correct horse", "unsupported backup KDF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := openBackup(tt.data, tt.passphrase)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRestoreKeepsConflictingKeys(t *testing.T) {
+	data, _ := sealedFixture(t, "correct horse")
+	bundle, err := openBackup(data, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshDir := filepath.Join(t.TempDir(), ".ssh")
+	configFile := filepath.Join(sshDir, "config")
+	if err := os.MkdirAll(sshDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(sshDir, "id_ed25519_work")
+	if err := os.WriteFile(keyPath, []byte("existing key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := planRestore(bundle, sshDir, configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item := plan.Items[0]; item.Kind != "key" || !item.Conflict {
+		t.Fatalf("first item = %+v, want a conflicting key", item)
+	}
+	if err := applyRestore(plan, sshDir, configFile, configFile, func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(keyPath); string(got) != "existing key" {
+		t.Errorf("existing key overwritten without consent: %q", got)
+	}
+	if reg, _ := loadKeyRegistry(sshDir); reg["work"] != nil {
+		t.Errorf("key record restored for a key that was not: %+v", reg["work"])
+	}
+
+	plan.Items[0].Overwrite = true
+	if err := applyRestore(plan, sshDir, configFile, configFile, func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(keyPath); !bytes.Equal(got, bundle.Keys[0].Private) {
+		t.Error("key not restored after choosing to overwrite")
+	}
+	archived, _ := filepath.Glob(filepath.Join(sshDir, "*", "*", "id_ed25519_work"))
+	found := false
+	for _, path := range archived {
+		if data, _ := os.ReadFile(path); string(data) == "existing key" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("overwritten key was not archived")
+	}
+}
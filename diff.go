@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const diffContext = 3
+
+// maxDiffCells bounds the LCS table of the changed region. Larger regions
+// are shown as all lines removed and re-added.
+const maxDiffCells = 4 << 20
+
+// diffOp is one line of a diff: ' ' kept, '-' removed or '+' added. ai and
+// bi are the line's position in before and after.
+type diffOp struct {
+	kind byte
+	text string
+	ai   int
+	bi   int
+}
+
+// unifiedDiff returns a unified diff turning before into after, or "" if
+// they are equal. Files are compared line by line.
+func unifiedDiff(name, before, after string) string {
+	if before == after {
+		return ""
+	}
+	a, b := splitLines(before), splitLines(after)
+
+	// Only the lines between the common prefix and suffix are compared, so
+	// appending to a long known_hosts costs no more than the new lines.
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	var ops []diffOp
+	for k := 0; k < pre; k++ {
+		ops = append(ops, diffOp{' ', a[k], k, k})
+	}
+	ops = append(ops, diffLines(a[pre:len(a)-suf], b[pre:len(b)-suf], pre, pre)...)
+	for k := suf; k > 0; k-- {
+		ops = append(ops, diffOp{' ', a[len(a)-k], len(a) - k, len(b) - k})
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", name, name)
+	for start := 0; start < len(ops); {
+		if ops[start].kind == ' ' {
+			start++
+			continue
+		}
+		// Grow the hunk while changes are within 2*diffContext lines of
+		// each other.
+		from := max(0, start-diffContext)
+		end := start
+		for k := start; k < len(ops); k++ {
+			if ops[k].kind != ' ' {
+				end = k
+			} else if k-end > 2*diffContext {
+				break
+			}
+		}
+		to := min(len(ops), end+diffContext+1)
+
+		aStart, bStart := ops[from].ai, ops[from].bi
+		aLen, bLen := 0, 0
+		for _, o := range ops[from:to] {
+			if o.kind != '+' {
+				aLen++
+			}
+			if o.kind != '-' {
+				bLen++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(aStart, aLen), hunkRange(bStart, bLen))
+		for _, o := range ops[from:to] {
+			out.WriteByte(o.kind)
+			out.WriteString(o.text)
+			out.WriteByte('\n')
+		}
+		start = to
+	}
+	return out.String()
+}
+
+// diffLines returns the operations turning a into b, which start at lines
+// aOff and bOff of their files.
+func diffLines(a, b []string, aOff, bOff int) []diffOp {
+	var ops []diffOp
+	if len(a)*len(b) > maxDiffCells {
+		for i, line := range a {
+			ops = append(ops, diffOp{'-', line, aOff + i, bOff})
+		}
+		for j, line := range b {
+			ops = append(ops, diffOp{'+', line, aOff + len(a), bOff + j})
+		}
+		return ops
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i], aOff + i, bOff + j})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, diffOp{'-', a[i], aOff + i, bOff + j})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j], aOff + i, bOff + j})
+			j++
+		}
+	}
+	return ops
+}
+
+func hunkRange(start, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if length == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, length)
+}
+
+func splitLines(s string) []string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
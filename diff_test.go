@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name, before, after, want string
+	}{
+		{"equal", "a\nb\n", "a\nb\n", ""},
+		{"create", "", "a\nb\n", "--- f\n+++ f\n@@ -0,0 +1,2 @@\n+a\n+b\n"},
+		{"delete all", "a\n", "", "--- f\n+++ f\n@@ -1 +0,0 @@\n-a\n"},
+		{"append", "a\nb\n", "a\nb\nc\n", "--- f\n+++ f\n@@ -1,2 +1,3 @@\n a\n b\n+c\n"},
+		{"change middle", "1\n2\n3\n4\n5\n6\n7\n8\n9\n", "1\n2\n3\n4\nX\n6\n7\n8\n9\n",
+			"--- f\n+++ f\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+X\n 6\n 7\n 8\n"},
+		{"two hunks", "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n", "X\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\nY\n",
+			"--- f\n+++ f\n@@ -1,4 +1,4 @@\n-1\n+X\n 2\n 3\n 4\n@@ -9,4 +9,4 @@\n 9\n 10\n 11\n-12\n+Y\n"},
+		{"no final newline", "a", "a\nb", "--- f\n+++ f\n@@ -1 +1,2 @@\n a\n+b\n"},
+	}
+	for _, tt := range tests {
+		if got := unifiedDiff("f", tt.before, tt.after); got != tt.want {
+			t.Errorf("%s:\ngot  %q\nwant %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestUnifiedDiffApplies checks random edits by applying the diff back to
+// the original.
+func TestUnifiedDiffApplies(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for n := 0; n < 500; n++ {
+		var a, b []string
+		for i := r.Intn(40); i > 0; i-- {
+			a = append(a, strconv.Itoa(r.Intn(5)))
+		}
+		for _, line := range a {
+			switch r.Intn(6) {
+			case 0:
+			case 1:
+				b = append(b, line, strconv.Itoa(r.Intn(5)))
+			case 2:
+				b = append(b, strconv.Itoa(r.Intn(5)))
+			default:
+				b = append(b, line)
+			}
+		}
+		before, after := joinLines(a), joinLines(b)
+		got, err := applyUnifiedDiff(before, unifiedDiff("f", before, after))
+		if err != nil || got != after {
+			t.Fatalf("%q -> %q: diff applies to %q (%v)\n%s", before, after, got, err, unifiedDiff("f", before, after))
+		}
+	}
+}
+
+func TestUnifiedDiffLargeFiles(t *testing.T) {
+	var lines []string
+	for i := 0; i < 20000; i++ {
+		lines = append(lines, fmt.Sprintf("host%d.example.com ssh-ed25519 AAAA%d", i, i))
+	}
+	before := joinLines(lines)
+
+	// Appending one line to a long known_hosts gives one small hunk.
+	after := before + "github.com ssh-ed25519 AAAAnew\n"
+	want := "--- known_hosts\n+++ known_hosts\n@@ -19998,3 +19998,4 @@\n" +
+		" " + lines[19997] + "\n " + lines[19998] + "\n " + lines[19999] + "\n+github.com ssh-ed25519 AAAAnew\n"
+	if got := unifiedDiff("known_hosts", before, after); got != want {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+
+	// A wholesale rewrite is too large for the LCS table and must still
+	// produce a diff that applies.
+	var rewritten []string
+	for _, line := range lines {
+		rewritten = append(rewritten, "@cert-authority "+line)
+	}
+	after = joinLines(rewritten)
+	diff := unifiedDiff("known_hosts", before, after)
+	if got, err := applyUnifiedDiff(before, diff); err != nil || got != after {
+		t.Errorf("rewrite diff does not apply: %v", err)
+	}
+}
+
+func joinLines(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// applyUnifiedDiff applies a diff made by unifiedDiff to before, checking
+// every context and removed line.
+func applyUnifiedDiff(before, diff string) (string, error) {
+	a := splitLines(before)
+	if diff == "" {
+		return before, nil
+	}
+	var out []string
+	pos := 0
+	lines := splitLines(diff)[2:]
+	for k := 0; k < len(lines); k++ {
+		var aStart, aLen, bStart, bLen int
+		if _, err := fmt.Sscanf(strings.NewReplacer(",", " ").Replace(hunkHeaderNumbers(lines[k])), "%d %d %d %d", &aStart, &aLen, &bStart, &bLen); err != nil {
+			return "", fmt.Errorf("bad hunk header %q: %w", lines[k], err)
+		}
+		if aLen > 0 {
+			aStart--
+		}
+		if aStart < pos {
+			return "", fmt.Errorf("overlapping hunk %q", lines[k])
+		}
+		out = append(out, a[pos:aStart]...)
+		pos = aStart
+		for k+1 < len(lines) && !strings.HasPrefix(lines[k+1], "@@") {
+			k++
+			line := lines[k]
+			switch line[0] {
+			case ' ', '-':
+				if pos >= len(a) || a[pos] != line[1:] {
+					return "", fmt.Errorf("line %d does not match %q", pos+1, line)
+				}
+				if line[0] == ' ' {
+					out = append(out, a[pos])
+				}
+				pos++
+			case '+':
+				out = append(out, line[1:])
+			}
+		}
+	}
+	out = append(out, a[pos:]...)
+	return joinLines(out), nil
+}
+
+// hunkHeaderNumbers rewrites "@@ -a,b +c,d @@" as "a,b c,d", filling in the
+// length 1 that unified diffs leave out.
+func hunkHeaderNumbers(header string) string {
+	fields := strings.Fields(strings.Trim(header, "@ "))
+	for i, f := range fields {
+		f = strings.TrimLeft(f, "-+")
+		if !strings.Contains(f, ",") {
+			f += ",1"
+		}
+		fields[i] = f
+	}
+	return strings.Join(fields, " ")
+}
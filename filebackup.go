@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	fileBackupDir        = "backups"
+	fileBackupTimeLayout = "20060102-150405.000000"
+	maxFileBackups       = 10
+)
+
+// fileBackup is a saved copy of an SSH file taken before it was changed.
+type fileBackup struct {
+	Path    string
+	Target  string
+	Created time.Time
+}
+
+// fileBackupName is the name backups of path are stored under: its path
+// relative to sshDir with separators flattened, so config.d/github.conf
+// becomes config.d_github.conf.
+func fileBackupName(sshDir, path string) string {
+	rel, err := filepath.Rel(sshDir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		rel = filepath.Base(path)
+	}
+	return strings.ReplaceAll(filepath.ToSlash(rel), "/", "_")
+}
+
+// backupFile copies path into sshDir/backups under a timestamped name,
+// keeping its permissions, and prunes all but the newest maxFileBackups
+// copies of it. It returns the copy's path, or "" if path does not exist.
+func backupFile(sshDir, path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(sshDir, fileBackupDir)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	backup := filepath.Join(dir, fileBackupName(sshDir, path)+"."+time.Now().Format(fileBackupTimeLayout)+".bak")
+	if err := writeNewFile(backup, data, info.Mode().Perm()); err != nil {
+		return "", err
+	}
+	_ = pruneFileBackups(sshDir, path, maxFileBackups)
+	return backup, nil
+}
+
+// listFileBackups returns the backups of path, newest first.
+func listFileBackups(sshDir, path string) ([]fileBackup, error) {
+	dir := filepath.Join(sshDir, fileBackupDir)
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	prefix := fileBackupName(sshDir, path) + "."
+	var backups []fileBackup
+	for _, e := range entries {
+		name := e.Name()
+		stamp, ok := strings.CutPrefix(name, prefix)
+		if !ok || e.IsDir() {
+			continue
+		}
+		stamp, ok = strings.CutSuffix(stamp, ".bak")
+		if !ok {
+			continue
+		}
+		created, err := time.ParseInLocation(fileBackupTimeLayout, stamp, time.Local)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, fileBackup{Path: filepath.Join(dir, name), Target: path, Created: created})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Created.After(backups[j].Created) })
+	return backups, nil
+}
+
+func pruneFileBackups(sshDir, path string, keep int) error {
+	backups, err := listFileBackups(sshDir, path)
+	if err != nil {
+		return err
+	}
+	for _, b := range backups[min(keep, len(backups)):] {
+		if err := os.Remove(b.Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSSHFile backs up path and atomically replaces it with data. Nothing
+// is written when the contents are unchanged. It is meant for the SSH
+// config and known_hosts; private keys are never copied into backups, and
+// replaced keys are archived with archiveKeyFiles instead.
+func writeSSHFile(sshDir, path string, data []byte, perm os.FileMode) error {
+	if current, err := os.ReadFile(path); err == nil && bytes.Equal(current, data) {
+		return nil
+	}
+	if _, err := backupFile(sshDir, path); err != nil {
+		return fmt.Errorf("back up %s: %w", filepath.Base(path), err)
+	}
+	return writeFileAtomic(path, data, perm)
+}
+
+// fileChange is a pending rewrite of an SSH file, kept so it can be shown
+// as a diff before anything is written.
+type fileChange struct {
+	Path   string
+	Before []byte
+	After  []byte
+	Perm   os.FileMode
+}
+
+func (c fileChange) diff() string {
+	return unifiedDiff(c.Path, string(c.Before), string(c.After))
+}
+
+// applyFileChanges writes changes in order through writeSSHFile. A file
+// that no longer has the contents its change was computed from is left
+// alone, so a stale preview never overwrites newer edits.
+func applyFileChanges(sshDir string, changes []fileChange) error {
+	for _, c := range changes {
+		current, err := readFileIfExists(c.Path)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(current, c.Before) {
+			return fmt.Errorf("%s changed since the preview; nothing was written to it", c.Path)
+		}
+		if err := os.MkdirAll(filepath.Dir(c.Path), 0o700); err != nil {
+			return err
+		}
+		if err := writeSSHFile(sshDir, c.Path, c.After, c.Perm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readFileIfExists is os.ReadFile, returning no data for a missing file.
+func readFileIfExists(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// restoreFileBackup puts the contents of b back in place. The current file
+// is backed up first, so a restore can itself be undone.
+func restoreFileBackup(sshDir string, b fileBackup) error {
+	data, err := os.ReadFile(b.Path)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(b.Path)
+	if err != nil {
+		return err
+	}
+	return writeSSHFile(sshDir, b.Target, data, info.Mode().Perm())
+}
+
+// backedUpFiles lists the SSH files the app writes to: configFile, the
+// files it includes and known_hosts.
+func backedUpFiles(sshDir, configFile string) []string {
+	files, err := configFiles(configFile)
+	if err != nil || len(files) == 0 {
+		files = []string{configFile}
+	}
+	if managed := managedConfigFile(sshDir); !containsPath(files, managed) {
+		files = append(files, managed)
+	}
+	return append(files, filepath.Join(sshDir, "known_hosts"))
+}
+
+func containsPath(paths []string, path string) bool {
+	for _, p := range paths {
+		if filepath.Clean(p) == filepath.Clean(path) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// publicKeyInfo summarises a public key the way `ssh-keygen -lv` does.
+type publicKeyInfo struct {
+	Type      string
+	Bits      int
+	Comment   string
+	SHA256    string
+	MD5       string
+	RandomArt string
+}
+
+func describePublicKey(authorizedKey string) (*publicKeyInfo, error) {
+	pub, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(authorizedKey))
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse public key: %w", err)
+	}
+	info := &publicKeyInfo{
+		Type:    pub.Type(),
+		Bits:    publicKeyBits(pub),
+		Comment: comment,
+		SHA256:  ssh.FingerprintSHA256(pub),
+		MD5:     ssh.FingerprintLegacyMD5(pub),
+	}
+	info.RandomArt = randomArt(pub, info.Bits)
+	return info, nil
+}
+
+// randomArtName is the short key type name OpenSSH prints in randomart
+// headers.
+func randomArtName(pub ssh.PublicKey) string {
+	switch pub.Type() {
+	case ssh.KeyAlgoED25519:
+		return "ED25519"
+	case ssh.KeyAlgoRSA:
+		return "RSA"
+	case ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521:
+		return "ECDSA"
+	case ssh.KeyAlgoDSA:
+		return "DSA"
+	}
+	return strings.ToUpper(pub.Type())
+}
+
+// randomArt draws OpenSSH's "drunken bishop" visualisation of the SHA256
+// fingerprint, matching the output of `ssh-keygen -lv`.
+func randomArt(pub ssh.PublicKey, bits int) string {
+	const (
+		width  = 17
+		height = 9
+		chars  = " .o+=*BOX@%&#/^SE"
+	)
+	maxCount := len(chars) - 1
+
+	digest := sha256.Sum256(pub.Marshal())
+	var field [width][height]int
+	x, y := width/2, height/2
+	for _, input := range digest {
+		for b := 0; b < 4; b++ {
+			if input&0x1 != 0 {
+				x++
+			} else {
+				x--
+			}
+			if input&0x2 != 0 {
+				y++
+			} else {
+				y--
+			}
+			x = max(0, min(x, width-1))
+			y = max(0, min(y, height-1))
+			if field[x][y] < maxCount-2 {
+				field[x][y]++
+			}
+			input >>= 2
+		}
+	}
+	field[width/2][height/2] = maxCount - 1
+	field[x][y] = maxCount
+
+	title := fmt.Sprintf("[%s %d]", randomArtName(pub), bits)
+	if len(title) > width {
+		title = fmt.Sprintf("[%s]", randomArtName(pub))
+	}
+	if len(title) > width {
+		title = title[:width]
+	}
+
+	var b strings.Builder
+	b.WriteString(randomArtBorder(title, width) + "\n")
+	for row := 0; row < height; row++ {
+		b.WriteByte('|')
+		for col := 0; col < width; col++ {
+			b.WriteByte(chars[min(field[col][row], maxCount)])
+		}
+		b.WriteString("|\n")
+	}
+	b.WriteString(randomArtBorder("[SHA256]", width))
+	return b.String()
+}
+
+func randomArtBorder(label string, width int) string {
+	left := (width - len(label)) / 2
+	return "+" + strings.Repeat("-", left) + label + strings.Repeat("-", width-left-len(label)) + "+"
+}
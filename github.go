@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -19,6 +20,27 @@ type githubKeyResponse struct {
 	Message string `json:"message"`
 }
 
+type githubKey struct {
+	ID    int64  `json:"id"`
+	Key   string `json:"key"`
+	Title string `json:"title"`
+}
+
+func newGitHubRequest(method, url, token string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	req.Header.Set("User-Agent", "github-ssh-manager")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
 func uploadKeyToGitHub(token, title, publicKey string) (*githubKeyResponse, error) {
 	payload := githubKeyRequest{Title: title, Key: publicKey}
 	body, err := json.Marshal(payload)
@@ -26,15 +48,10 @@ func uploadKeyToGitHub(token, title, publicKey string) (*githubKeyResponse, erro
 		return nil, err
 	}
 
-	req, err := http.NewRequest(http.MethodPost, "https://api.github.com/user/keys", bytes.NewReader(body))
+	req, err := newGitHubRequest(http.MethodPost, "https://api.github.com/user/keys", token, body)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Authorization", "Bearer "+token)
-	req.Header.Set("Accept", "application/vnd.github+json")
-	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
-	req.Header.Set("User-Agent", "github-ssh-manager")
-	req.Header.Set("Content-Type", "application/json")
 
 	client := &http.Client{Timeout: 20 * time.Second}
 	resp, err := client.Do(req)
@@ -56,3 +73,86 @@ func uploadKeyToGitHub(token, title, publicKey string) (*githubKeyResponse, erro
 	}
 	return &decoded, nil
 }
+
+func listGitHubKeys(token string) ([]githubKey, error) {
+	client := &http.Client{Timeout: 20 * time.Second}
+	var keys []githubKey
+	for page := 1; ; page++ {
+		url := fmt.Sprintf("https://api.github.com/user/keys?per_page=100&page=%d", page)
+		req, err := newGitHubRequest(http.MethodGet, url, token, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			err := githubError(resp)
+			resp.Body.Close()
+			return nil, err
+		}
+		var batch []githubKey
+		err = json.NewDecoder(resp.Body).Decode(&batch)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, batch...)
+		if len(batch) < 100 {
+			return keys, nil
+		}
+	}
+}
+
+// findGitHubKey returns the GitHub key whose key material matches the
+// authorized_keys line publicKey, ignoring comments.
+func findGitHubKey(token, publicKey string) (*githubKey, error) {
+	keys, err := listGitHubKeys(token)
+	if err != nil {
+		return nil, err
+	}
+	want := publicKeyMaterial(publicKey)
+	for _, k := range keys {
+		if publicKeyMaterial(k.Key) == want {
+			return &k, nil
+		}
+	}
+	return nil, nil
+}
+
+// publicKeyMaterial strips the comment from an authorized_keys line, leaving
+// "<type> <base64>".
+func publicKeyMaterial(line string) string {
+	fields := strings.Fields(line)
+	if len(fields) > 2 {
+		fields = fields[:2]
+	}
+	return strings.Join(fields, " ")
+}
+
+func deleteGitHubKey(token string, id int64) error {
+	req, err := newGitHubRequest(http.MethodDelete, fmt.Sprintf("https://api.github.com/user/keys/%d", id), token, nil)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 20 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return githubError(resp)
+	}
+	return nil
+}
+
+func githubError(resp *http.Response) error {
+	var decoded githubKeyResponse
+	_ = json.NewDecoder(resp.Body).Decode(&decoded)
+	if decoded.Message == "" {
+		decoded.Message = fmt.Sprintf("GitHub API returned status %d", resp.StatusCode)
+	}
+	return fmt.Errorf("%s", decoded.Message)
+}
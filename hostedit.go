@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// hostEditorFields are the options the Host editor shows as separate
+// fields. Everything else in the block is edited as free-form lines.
+var hostEditorFields = []string{"HostName", "User", "Port", "IdentityFile", "IdentitiesOnly", "AddKeysToAgent"}
+
+var configKeywordPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*$`)
+
+// hostEdit is the desired state of a Host block. Fields maps each of
+// hostEditorFields to its value, "" meaning the option is removed. Extra
+// holds the remaining options as "Keyword value" lines.
+type hostEdit struct {
+	Fields map[string]string
+	Extra  []string
+}
+
+// hostEditState reads the current values of hostAlias's block for the
+// editor.
+func hostEditState(config []byte, hostAlias string) (hostEdit, error) {
+	b := parseSSHConfig(config).findHost(hostAlias)
+	if b == nil {
+		return hostEdit{}, fmt.Errorf("host alias %s not found in SSH config", hostAlias)
+	}
+	edit := hostEdit{Fields: map[string]string{}}
+	for _, l := range b.Lines {
+		if l.Keyword == "" {
+			continue
+		}
+		if field := editorField(l.Keyword); field != "" {
+			if _, seen := edit.Fields[field]; !seen {
+				edit.Fields[field] = l.value()
+			}
+			continue
+		}
+		edit.Extra = append(edit.Extra, renderConfigOption(l.Keyword, l.Args))
+	}
+	return edit, nil
+}
+
+func editorField(keyword string) string {
+	for _, f := range hostEditorFields {
+		if strings.EqualFold(f, keyword) {
+			return f
+		}
+	}
+	return ""
+}
+
+func renderConfigOption(keyword string, args []string) string {
+	return keyword + " " + renderConfigArgs(args)
+}
+
+// renderConfigArgs quotes args where needed and joins them with spaces.
+func renderConfigArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = quoteConfigArg(a)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// validateHostEdit checks edit before it is written. homeDir expands "~" in
+// IdentityFile so the file can be checked for existence. An empty HostName
+// is allowed, since ssh then connects to the alias itself.
+func validateHostEdit(edit hostEdit, homeDir string) error {
+	if v := edit.Fields["HostName"]; strings.ContainsAny(v, " \t") {
+		return fmt.Errorf("HostName must be a single host name")
+	}
+	if v := edit.Fields["User"]; strings.ContainsAny(v, " \t") {
+		return fmt.Errorf("User must not contain spaces")
+	}
+	if v := edit.Fields["Port"]; v != "" {
+		if port, err := strconv.Atoi(v); err != nil || port < 1 || port > 65535 {
+			return fmt.Errorf("Port must be a number between 1 and 65535")
+		}
+	}
+	if v := edit.Fields["IdentityFile"]; v != "" && !strings.Contains(v, "%") {
+		if _, err := os.Stat(expandHome(v, homeDir)); err != nil {
+			return fmt.Errorf("IdentityFile %s does not exist", v)
+		}
+	}
+	for _, name := range []string{"IdentitiesOnly", "AddKeysToAgent"} {
+		v := strings.ToLower(edit.Fields[name])
+		if v != "" && v != "yes" && v != "no" && !(name == "AddKeysToAgent" && (v == "ask" || v == "confirm")) {
+			return fmt.Errorf("%s must be yes or no", name)
+		}
+	}
+	for _, line := range edit.Extra {
+		l := parseConfigLine(line)
+		switch {
+		case !configKeywordPattern.MatchString(l.Keyword):
+			return fmt.Errorf("invalid option line %q", line)
+		case len(l.Args) == 0:
+			return fmt.Errorf("option %s needs a value", l.Keyword)
+		case l.is("host") || l.is("match"):
+			return fmt.Errorf("%s cannot be used inside a Host entry", l.Keyword)
+		case editorField(l.Keyword) != "":
+			return fmt.Errorf("set %s in its own field", editorField(l.Keyword))
+		}
+	}
+	return nil
+}
+
+// applyHostEdit rewrites hostAlias's block to match edit. Unchanged lines,
+// comments and indentation are kept.
+func applyHostEdit(config []byte, hostAlias string, edit hostEdit) ([]byte, error) {
+	cfg := parseSSHConfig(config)
+	b := cfg.findHost(hostAlias)
+	if b == nil {
+		return nil, fmt.Errorf("host alias %s not found in SSH config", hostAlias)
+	}
+
+	for _, field := range hostEditorFields {
+		value := strings.TrimSpace(edit.Fields[field])
+		current := b.option(field)
+		switch {
+		case value == "":
+			b.removeOption(field)
+		case current != nil && current.value() == value:
+		case field == "IdentityFile":
+			b.setOption(field, quoteConfigArg(filepath.ToSlash(value)), cfg.newline)
+		default:
+			b.setOption(field, quoteConfigArg(value), cfg.newline)
+		}
+	}
+
+	wanted := map[string]bool{}
+	for _, line := range edit.Extra {
+		l := parseConfigLine(line)
+		wanted[strings.ToLower(renderConfigOption(l.Keyword, l.Args))] = true
+	}
+	present := map[string]bool{}
+	kept := b.Lines[:0]
+	for _, l := range b.Lines {
+		if l.Keyword != "" && editorField(l.Keyword) == "" {
+			key := strings.ToLower(renderConfigOption(l.Keyword, l.Args))
+			if !wanted[key] {
+				continue
+			}
+			present[key] = true
+		}
+		kept = append(kept, l)
+	}
+	b.Lines = kept
+	for _, line := range edit.Extra {
+		l := parseConfigLine(line)
+		if key := strings.ToLower(renderConfigOption(l.Keyword, l.Args)); !present[key] {
+			b.appendOption(strings.TrimSpace(line), cfg.newline)
+			present[key] = true
+		}
+	}
+	return cfg.Bytes(), nil
+}
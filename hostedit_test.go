@@ -0,0 +1,148 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestHostEditState(t *testing.T) {
+	config := "Host *\n  User nobody\n\nHost gh other\n  HostName github.com\n  # note\n  user git\n  IdentityFile \"~/.ssh/my key\"\n  IdentityFile ~/.ssh/second\n  ForwardAgent no\n  SendEnv LANG LC_*\n"
+	edit, err := hostEditState([]byte(config), "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantFields := map[string]string{"HostName": "github.com", "User": "git", "IdentityFile": "~/.ssh/my key"}
+	if !reflect.DeepEqual(edit.Fields, wantFields) {
+		t.Errorf("Fields = %q, want %q", edit.Fields, wantFields)
+	}
+	if want := []string{"ForwardAgent no", "SendEnv LANG LC_*"}; !reflect.DeepEqual(edit.Extra, want) {
+		t.Errorf("Extra = %q, want %q", edit.Extra, want)
+	}
+	if _, err := hostEditState([]byte(config), "missing"); err == nil {
+		t.Error("expected an error for a missing alias")
+	}
+}
+
+func TestValidateHostEdit(t *testing.T) {
+	home := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(home, ".ssh"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".ssh", "id_ed25519_work"), []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		fields map[string]string
+		extra  []string
+		ok     bool
+	}{
+		{"minimal", map[string]string{"HostName": "github.com"}, nil, true},
+		{"no HostName", map[string]string{"User": "git"}, nil, true},
+		{"everything", map[string]string{
+			"HostName": "ssh.github.com", "User": "git", "Port": "443",
+			"IdentityFile": "~/.ssh/id_ed25519_work", "IdentitiesOnly": "yes", "AddKeysToAgent": "confirm",
+		}, []string{"ForwardAgent no", "SendEnv LANG LC_*"}, true},
+		{"IdentityFile with token", map[string]string{"IdentityFile": "~/.ssh/%r"}, nil, true},
+		{"HostName with space", map[string]string{"HostName": "github .com"}, nil, false},
+		{"User with space", map[string]string{"User": "g it"}, nil, false},
+		{"Port zero", map[string]string{"Port": "0"}, nil, false},
+		{"Port too large", map[string]string{"Port": "65536"}, nil, false},
+		{"Port not a number", map[string]string{"Port": "ssh"}, nil, false},
+		{"missing IdentityFile", map[string]string{"IdentityFile": "~/.ssh/missing"}, nil, false},
+		{"IdentitiesOnly ask", map[string]string{"IdentitiesOnly": "ask"}, nil, false},
+		{"AddKeysToAgent maybe", map[string]string{"AddKeysToAgent": "maybe"}, nil, false},
+		{"extra without value", nil, []string{"ForwardAgent"}, false},
+		{"extra bad keyword", nil, []string{"Forward-Agent no"}, false},
+		{"extra Host", nil, []string{"Host other"}, false},
+		{"extra Match", nil, []string{"Match all"}, false},
+		{"extra editor field", nil, []string{"port 22"}, false},
+	}
+	for _, tt := range tests {
+		err := validateHostEdit(hostEdit{Fields: tt.fields, Extra: tt.extra}, home)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: validateHostEdit() = %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestApplyHostEdit(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		alias  string
+		fields map[string]string
+		extra  []string
+		want   string
+	}{
+		{
+			"no changes",
+			"Host gh\n  HostName github.com\n  # keep\n  User git\n  ForwardAgent no\n",
+			"gh",
+			map[string]string{"HostName": "github.com", "User": "git"},
+			[]string{"ForwardAgent no"},
+			"Host gh\n  HostName github.com\n  # keep\n  User git\n  ForwardAgent no\n",
+		},
+		{
+			"set, add and remove fields",
+			"Host gh\n  HostName github.com\n  User git\n\nHost other\n  User x\n",
+			"gh",
+			map[string]string{"HostName": "ssh.github.com", "Port": "443"},
+			nil,
+			"Host gh\n  HostName ssh.github.com\n  Port 443\n\nHost other\n  User x\n",
+		},
+		{
+			"block without HostName",
+			"Host github.com\r\n  User git\r\n",
+			"github.com",
+			map[string]string{"User": "git", "IdentityFile": "~/.ssh/id_ed25519_work"},
+			nil,
+			"Host github.com\r\n  User git\r\n  IdentityFile ~/.ssh/id_ed25519_work\r\n",
+		},
+		{
+			"IdentityFile needing quotes",
+			"Host gh\n  IdentityFile ~/.ssh/old\n",
+			"gh",
+			map[string]string{"IdentityFile": "/home/jürgen/my keys/tab\there"},
+			nil,
+			"Host gh\n  IdentityFile \"/home/jürgen/my keys/tab\there\"\n",
+		},
+		{
+			"extra lines replaced",
+			"Host gh\n  ForwardAgent no\n  LogLevel ERROR\n",
+			"gh",
+			nil,
+			[]string{"logLevel ERROR", "SendEnv LANG"},
+			"Host gh\n  LogLevel ERROR\n  SendEnv LANG\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := applyHostEdit([]byte(tt.config), tt.alias, hostEdit{Fields: tt.fields, Extra: tt.extra})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got  %q\nwant %q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyHostEditIdentityFileRoundTrip(t *testing.T) {
+	for _, keyPath := range identityFilePaths {
+		out, err := applyHostEdit([]byte("Host gh\n  User git\n"), "gh", hostEdit{Fields: map[string]string{"IdentityFile": keyPath}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		edit, err := hostEditState(out, "gh")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := edit.Fields["IdentityFile"]; got != keyPath {
+			t.Errorf("IdentityFile reads back as %q, want %q", got, keyPath)
+		}
+	}
+}
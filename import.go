@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// parsePrivateKeyData parses a private key in any format x/crypto/ssh
+// understands. An encrypted key without passphrase yields an
+// *ssh.PassphraseMissingError so callers can prompt and retry.
+func parsePrivateKeyData(data []byte, passphrase string) (crypto.Signer, error) {
+	var key any
+	var err error
+	if passphrase == "" {
+		key, err = ssh.ParseRawPrivateKey(data)
+	} else {
+		key, err = ssh.ParseRawPrivateKeyWithPassphrase(data, []byte(passphrase))
+	}
+	if err != nil {
+		return nil, err
+	}
+	// x/crypto returns ed25519 keys as a pointer, which is not a crypto.Signer.
+	if k, ok := key.(*ed25519.PrivateKey); ok {
+		key = *k
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	return signer, nil
+}
+
+func isPassphraseMissing(err error) bool {
+	var missing *ssh.PassphraseMissingError
+	return errors.As(err, &missing)
+}
+
+// importPrivateKey validates a private key and stores it in sshDir under the
+// keyBasePath naming scheme for label, deriving the .pub next to it. OpenSSH
+// keys are copied unchanged so an encrypted key stays encrypted; PEM and
+// PuTTY keys are converted to OpenSSH format, re-encrypted with the same
+// passphrase.
+func importPrivateKey(sshDir, label, alias string, data []byte, passphrase string) (string, error) {
+	var signer crypto.Signer
+	var err error
+	if isPPK(data) {
+		signer, _, err = parsePPK(data, passphrase)
+	} else {
+		signer, err = parsePrivateKeyData(data, passphrase)
+	}
+	if err != nil {
+		return "", err
+	}
+	pub, err := ssh.NewPublicKey(signer.Public())
+	if err != nil {
+		return "", fmt.Errorf("derive public key: %w", err)
+	}
+	algo, err := algorithmForPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	if existing, ok := findKeyBasePath(sshDir, label); ok {
+		return "", fmt.Errorf("key already exists: %s", existing)
+	}
+
+	v := newTemplateVars(label, alias, algo)
+	keyPath := keyBasePath(sshDir, v)
+	comment := naming.comment(v)
+	if !isOpenSSHPrivateKey(data) {
+		if err := writeKeyPair(keyPath, signer, comment, passphrase, defaultKDFRounds); err != nil {
+			return "", err
+		}
+		return keyPath, nil
+	}
+
+	if err := writeNewFile(keyPath, data, 0o600); err != nil {
+		return "", err
+	}
+	if err := writeNewFile(keyPath+".pub", []byte(authorizedKeyLine(pub, comment)), 0o644); err != nil {
+		_ = os.Remove(keyPath)
+		return "", err
+	}
+	if runtime.GOOS != "windows" {
+		_ = os.Chmod(keyPath, 0o600)
+		_ = os.Chmod(keyPath+".pub", 0o644)
+	}
+	return keyPath, nil
+}
+
+func isOpenSSHPrivateKey(data []byte) bool {
+	block, _ := pem.Decode(data)
+	return block != nil && block.Type == "OPENSSH PRIVATE KEY"
+}
+
+// loadManagedKey reads the private key of label from sshDir along with the
+// comment of its public key.
+func loadManagedKey(sshDir, label, passphrase string) (crypto.Signer, string, string, error) {
+	keyPath, ok := findKeyBasePath(sshDir, label)
+	if !ok {
+		return nil, "", "", fmt.Errorf("no key found for label %q in %s", label, sshDir)
+	}
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, "", "", err
+	}
+	signer, err := parsePrivateKeyData(data, passphrase)
+	if err != nil {
+		return nil, "", keyPath, err
+	}
+	comment := label + "@github"
+	if pub, err := ssh.NewPublicKey(signer.Public()); err == nil {
+		if algo, err := algorithmForPublicKey(pub); err == nil {
+			comment = naming.comment(newTemplateVars(label, "", algo))
+		}
+	}
+	if pub, err := os.ReadFile(keyPath + ".pub"); err == nil {
+		if fields := strings.Fields(string(pub)); len(fields) > 2 {
+			comment = strings.Join(fields[2:], " ")
+		}
+	}
+	return signer, comment, keyPath, nil
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/pem"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// maxKeyFileSize bounds how much of a file the inventory reads when checking
+// whether it is a key; real keys are a few KiB at most.
+const maxKeyFileSize = 64 << 10
+
+// inventoryKey describes one key pair found in the SSH directory. Path is
+// the private key path, or the .pub path without its extension when only
+// the public half exists.
+type inventoryKey struct {
+	Path        string
+	Type        string
+	Bits        int
+	Fingerprint string
+	Comment     string
+	Encrypted   bool
+	HasPrivate  bool
+	HasPublic   bool
+	Hosts       []string
+}
+
+func (k inventoryKey) status() string {
+	switch {
+	case !k.HasPrivate:
+		return "orphaned .pub"
+	case !k.HasPublic:
+		return "missing .pub"
+	}
+	return "ok"
+}
+
+// scanKeyInventory lists every private and public key directly inside
+// sshDir and the Host entries of configFile whose IdentityFile names them.
+func scanKeyInventory(sshDir, configFile string) ([]inventoryKey, error) {
+	entries, err := os.ReadDir(sshDir)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := map[string]*inventoryKey{}
+	get := func(path string) *inventoryKey {
+		if k, ok := keys[path]; ok {
+			return k
+		}
+		k := &inventoryKey{Path: path}
+		keys[path] = k
+		return k
+	}
+
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		path := filepath.Join(sshDir, entry.Name())
+		data, err := readSmallFile(path)
+		if err != nil {
+			continue
+		}
+
+		if strings.HasSuffix(entry.Name(), ".pub") {
+			pub, comment, _, _, err := ssh.ParseAuthorizedKey(data)
+			if err != nil {
+				continue
+			}
+			k := get(strings.TrimSuffix(path, ".pub"))
+			k.HasPublic = true
+			k.Comment = comment
+			k.setPublicKey(pub)
+			continue
+		}
+
+		pub, encrypted, ok := inspectPrivateKey(data)
+		if !ok {
+			continue
+		}
+		k := get(path)
+		k.HasPrivate = true
+		k.Encrypted = encrypted
+		if pub != nil {
+			k.setPublicKey(pub)
+		}
+	}
+
+	refs := configTreeIdentityFiles(configFile, filepath.Dir(sshDir))
+	for path, k := range keys {
+		k.Hosts = refs[filepath.Clean(path)]
+	}
+
+	result := make([]inventoryKey, 0, len(keys))
+	for _, k := range keys {
+		result = append(result, *k)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Path < result[j].Path })
+	return result, nil
+}
+
+func (k *inventoryKey) setPublicKey(pub ssh.PublicKey) {
+	k.Type = pub.Type()
+	k.Bits = publicKeyBits(pub)
+	k.Fingerprint = ssh.FingerprintSHA256(pub)
+}
+
+func readSmallFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(io.LimitReader(f, maxKeyFileSize))
+}
+
+// inspectPrivateKey reports whether data holds a private key, whether it is
+// encrypted and, when available without a passphrase, its public key.
+func inspectPrivateKey(data []byte) (ssh.PublicKey, bool, bool) {
+	if isPPK(data) {
+		return nil, false, false
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || !strings.HasSuffix(block.Type, "PRIVATE KEY") {
+		return nil, false, false
+	}
+	signer, err := ssh.ParsePrivateKey(data)
+	if err == nil {
+		return signer.PublicKey(), false, true
+	}
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		return missing.PublicKey, true, true
+	}
+	return nil, false, true
+}
+
+// configIdentityFiles maps every IdentityFile in config to the Host patterns
+// of the blocks that reference it. Paths are cleaned and "~" is expanded
+// against homeDir so they can be compared with files on disk.
+func configIdentityFiles(config []byte, homeDir string) map[string][]string {
+	refs := map[string][]string{}
+	cfg := parseSSHConfig(config)
+	add := func(name string, b *configBlock) {
+		for _, l := range b.Lines {
+			if !l.is("identityfile") || len(l.Args) == 0 {
+				continue
+			}
+			path := expandHome(l.value(), homeDir)
+			refs[path] = append(refs[path], name)
+		}
+	}
+	add("(global)", cfg.Global)
+	for _, b := range cfg.Blocks {
+		name := strings.Join(b.Header.Args, " ")
+		if b.Header.is("match") {
+			name = strings.TrimSpace(b.Header.raw)
+		}
+		add(name, b)
+	}
+	return refs
+}
+
+// refHeader turns a block name from configIdentityFiles back into its Host
+// or Match line, or nil for the global section.
+func refHeader(name string) *configLine {
+	if name == "(global)" {
+		return nil
+	}
+	if h := parseConfigLine(name); h.is("match") {
+		return h
+	}
+	return parseConfigLine("Host " + name)
+}
+
+// configTreeIdentityFiles is configIdentityFiles over configFile and every
+// file it includes.
+func configTreeIdentityFiles(configFile, homeDir string) map[string][]string {
+	refs := map[string][]string{}
+	files, _ := configFiles(configFile)
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			continue
+		}
+		for path, hosts := range configIdentityFiles(data, homeDir) {
+			refs[path] = append(refs[path], hosts...)
+		}
+	}
+	return refs
+}
+
+func expandHome(path, homeDir string) string {
+	if path == "~" {
+		return homeDir
+	}
+	if strings.HasPrefix(path, "~/") {
+		path = filepath.Join(homeDir, path[2:])
+	}
+	return filepath.Clean(filepath.FromSlash(path))
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	defaultMaxKeyAgeDays = 180
+	keyExpiryWarningDays = 14
+	keyRegistryFile      = "github-ssh-manager.json"
+)
+
+// keyRecord tracks the lifetime of one account's key. Estimated is set when
+// Created was taken from the file's modification time because the key was
+// made before tracking existed.
+type keyRecord struct {
+	KeyPath    string    `json:"key_path"`
+	Created    time.Time `json:"created"`
+	Estimated  bool      `json:"estimated,omitempty"`
+	Uploaded   time.Time `json:"uploaded,omitzero"`
+	MaxAgeDays int       `json:"max_age_days,omitempty"`
+}
+
+// keyRegistry maps account labels to their key records. It is stored as
+// JSON next to the keys.
+type keyRegistry map[string]*keyRecord
+
+func loadKeyRegistry(sshDir string) (keyRegistry, error) {
+	reg := keyRegistry{}
+	data, err := os.ReadFile(filepath.Join(sshDir, keyRegistryFile))
+	if os.IsNotExist(err) {
+		return reg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &reg); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", keyRegistryFile, err)
+	}
+	return reg, nil
+}
+
+func (r keyRegistry) save(sshDir string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(sshDir, keyRegistryFile), append(data, '\n'), 0o600)
+}
+
+// recordCreated starts tracking a new key for label, keeping the account's
+// max age setting.
+func (r keyRegistry) recordCreated(label, keyPath string, at time.Time) {
+	rec := &keyRecord{KeyPath: keyPath, Created: at}
+	if old, ok := r[label]; ok {
+		rec.MaxAgeDays = old.MaxAgeDays
+	}
+	r[label] = rec
+}
+
+func (r keyRegistry) recordUploaded(label string, at time.Time) {
+	if rec, ok := r[label]; ok {
+		rec.Uploaded = at
+	}
+}
+
+// adoptUntracked adds records for private keys in sshDir that follow the
+// <prefix>_<label> naming scheme but are not tracked yet, dating them by
+// modification time. It reports whether anything was added.
+func (r keyRegistry) adoptUntracked(sshDir, configFile string) (bool, error) {
+	keys, err := scanKeyInventory(sshDir, configFile)
+	if err != nil {
+		return false, err
+	}
+	added := false
+	for _, k := range keys {
+		label := guessKeyLabel(k.Path)
+		if !k.HasPrivate || label == "" {
+			continue
+		}
+		if _, ok := r[label]; ok {
+			continue
+		}
+		info, err := os.Stat(k.Path)
+		if err != nil {
+			continue
+		}
+		r[label] = &keyRecord{KeyPath: k.Path, Created: info.ModTime(), Estimated: true}
+		added = true
+	}
+	return added, nil
+}
+
+func (rec *keyRecord) maxAge() int {
+	if rec.MaxAgeDays > 0 {
+		return rec.MaxAgeDays
+	}
+	return defaultMaxKeyAgeDays
+}
+
+type keyAge struct {
+	Label    string
+	Record   keyRecord
+	AgeDays  int
+	DaysLeft int
+}
+
+func (k keyAge) state() string {
+	switch {
+	case k.DaysLeft < 0:
+		return "expired"
+	case k.DaysLeft <= keyExpiryWarningDays:
+		return "expiring soon"
+	}
+	return "ok"
+}
+
+// keyAges returns the age of every tracked key whose file still exists,
+// closest to expiry first.
+func (r keyRegistry) keyAges(now time.Time) []keyAge {
+	var ages []keyAge
+	for label, rec := range r {
+		if _, err := os.Stat(rec.KeyPath); err != nil {
+			continue
+		}
+		age := int(now.Sub(rec.Created).Hours() / 24)
+		ages = append(ages, keyAge{Label: label, Record: *rec, AgeDays: age, DaysLeft: rec.maxAge() - age})
+	}
+	sort.Slice(ages, func(i, j int) bool {
+		if ages[i].DaysLeft != ages[j].DaysLeft {
+			return ages[i].DaysLeft < ages[j].DaysLeft
+		}
+		return ages[i].Label < ages[j].Label
+	})
+	return ages
+}
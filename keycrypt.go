@@ -0,0 +1,224 @@
+package main
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/blowfish"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	defaultKDFRounds = 16
+	// maxKDFRounds matches the limit golang.org/x/crypto/ssh enforces when
+	// decrypting, so every key written here can be read back by the app.
+	maxKDFRounds = 2048
+
+	openSSHKeyMagic = "openssh-key-v1\x00"
+)
+
+// openSSHKeyEnvelope is the outer structure of an openssh-key-v1 blob as
+// described in OpenSSH's PROTOCOL.key.
+type openSSHKeyEnvelope struct {
+	CipherName   string
+	KdfName      string
+	KdfOpts      string
+	NumKeys      uint32
+	PubKey       []byte
+	PrivKeyBlock []byte
+	Rest         []byte `ssh:"rest"`
+}
+
+// marshalPrivateKey encodes key in OpenSSH format. With an empty passphrase
+// the key is stored unencrypted; otherwise it is encrypted with aes256-ctr
+// using a bcrypt_pbkdf derived key and the given number of KDF rounds.
+func marshalPrivateKey(key crypto.PrivateKey, comment, passphrase string, rounds int) (*pem.Block, error) {
+	block, err := ssh.MarshalPrivateKey(key, comment)
+	if err != nil {
+		return nil, err
+	}
+	if passphrase == "" {
+		return block, nil
+	}
+	if err := validateKDFRounds(rounds); err != nil {
+		return nil, err
+	}
+	return encryptOpenSSHBlock(block, []byte(passphrase), rounds)
+}
+
+func encryptOpenSSHBlock(block *pem.Block, passphrase []byte, rounds int) (*pem.Block, error) {
+	if len(block.Bytes) < len(openSSHKeyMagic) || string(block.Bytes[:len(openSSHKeyMagic)]) != openSSHKeyMagic {
+		return nil, errors.New("not an OpenSSH private key")
+	}
+	var env openSSHKeyEnvelope
+	if err := ssh.Unmarshal(block.Bytes[len(openSSHKeyMagic):], &env); err != nil {
+		return nil, fmt.Errorf("parse OpenSSH private key: %w", err)
+	}
+	if env.CipherName != "none" || env.KdfName != "none" {
+		return nil, errors.New("private key is already encrypted")
+	}
+
+	// The unencrypted block is padded to 8 bytes with 1, 2, 3, ...; extend
+	// the same sequence up to the AES block size.
+	plain := env.PrivKeyBlock
+	last := openSSHPaddingLen(plain)
+	for len(plain)%aes.BlockSize != 0 {
+		last++
+		plain = append(plain, last)
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	k, err := bcryptPBKDF(passphrase, salt, rounds, 32+aes.BlockSize)
+	if err != nil {
+		return nil, err
+	}
+	c, err := aes.NewCipher(k[:32])
+	if err != nil {
+		return nil, err
+	}
+	encrypted := make([]byte, len(plain))
+	cipher.NewCTR(c, k[32:]).XORKeyStream(encrypted, plain)
+
+	env.CipherName = "aes256-ctr"
+	env.KdfName = "bcrypt"
+	env.KdfOpts = string(ssh.Marshal(struct {
+		Salt   []byte
+		Rounds uint32
+	}{salt, uint32(rounds)}))
+	env.PrivKeyBlock = encrypted
+
+	return &pem.Block{
+		Type:  "OPENSSH PRIVATE KEY",
+		Bytes: append([]byte(openSSHKeyMagic), ssh.Marshal(env)...),
+	}, nil
+}
+
+// openSSHPaddingLen reports how many 1, 2, 3, ... padding bytes terminate an
+// OpenSSH private key block.
+func openSSHPaddingLen(block []byte) byte {
+	n := len(block)
+	if n == 0 {
+		return 0
+	}
+	pad := block[n-1]
+	if pad == 0 || pad >= aes.BlockSize || int(pad) > n {
+		return 0
+	}
+	for i := byte(1); i <= pad; i++ {
+		if block[n-int(pad)+int(i)-1] != i {
+			return 0
+		}
+	}
+	return pad
+}
+
+// loadSigner reads an OpenSSH, PKCS#1, PKCS#8 or SEC 1 private key,
+// decrypting it with passphrase when it is encrypted.
+func loadSigner(keyPath, passphrase string) (ssh.Signer, error) {
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(data)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		if passphrase == "" {
+			return nil, fmt.Errorf("%s is encrypted: passphrase required", keyPath)
+		}
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(data, []byte(passphrase))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot load private key %s: %w", keyPath, err)
+	}
+	return signer, nil
+}
+
+// bcryptPBKDF implements OpenBSD's bcrypt_pbkdf(3), the KDF used by
+// OpenSSH for passphrase-protected private keys.
+func bcryptPBKDF(password, salt []byte, rounds, keyLen int) ([]byte, error) {
+	const blockSize = 32
+	if rounds < 1 {
+		return nil, errors.New("bcrypt_pbkdf: number of rounds is too small")
+	}
+	if len(password) == 0 {
+		return nil, errors.New("bcrypt_pbkdf: empty password")
+	}
+	if len(salt) == 0 || len(salt) > 1<<20 {
+		return nil, errors.New("bcrypt_pbkdf: bad salt length")
+	}
+	if keyLen > 1024 {
+		return nil, errors.New("bcrypt_pbkdf: keyLen is too large")
+	}
+
+	numBlocks := (keyLen + blockSize - 1) / blockSize
+	key := make([]byte, numBlocks*blockSize)
+
+	h := sha512.New()
+	h.Write(password)
+	shapass := h.Sum(nil)
+
+	shasalt := make([]byte, 0, sha512.Size)
+	cnt, tmp := make([]byte, 4), make([]byte, blockSize)
+	for block := 1; block <= numBlocks; block++ {
+		h.Reset()
+		h.Write(salt)
+		cnt[0] = byte(block >> 24)
+		cnt[1] = byte(block >> 16)
+		cnt[2] = byte(block >> 8)
+		cnt[3] = byte(block)
+		h.Write(cnt)
+		if err := bcryptHash(tmp, shapass, h.Sum(shasalt)); err != nil {
+			return nil, err
+		}
+
+		out := make([]byte, blockSize)
+		copy(out, tmp)
+		for i := 2; i <= rounds; i++ {
+			h.Reset()
+			h.Write(tmp)
+			if err := bcryptHash(tmp, shapass, h.Sum(shasalt)); err != nil {
+				return nil, err
+			}
+			for j := range out {
+				out[j] ^= tmp[j]
+			}
+		}
+
+		for i, v := range out {
+			key[i*numBlocks+(block-1)] = v
+		}
+	}
+	return key[:keyLen], nil
+}
+
+func bcryptHash(out, shapass, shasalt []byte) error {
+	c, err := blowfish.NewSaltedCipher(shapass, shasalt)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < 64; i++ {
+		blowfish.ExpandKey(shasalt, c)
+		blowfish.ExpandKey(shapass, c)
+	}
+	copy(out, "OxychromaticBlowfishSwatDynamite")
+	for i := 0; i < 32; i += 8 {
+		for j := 0; j < 64; j++ {
+			c.Encrypt(out[i:i+8], out[i:i+8])
+		}
+	}
+	// bcrypt_pbkdf emits its state as little-endian words.
+	for i := 0; i < 32; i += 4 {
+		out[i+3], out[i+2], out[i+1], out[i] = out[i], out[i+1], out[i+2], out[i+3]
+	}
+	return nil
+}
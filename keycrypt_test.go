@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/pem"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestBcryptPBKDF(t *testing.T) {
+	// Vectors from the OpenBSD reference implementation.
+	tests := []struct {
+		rounds         int
+		password, salt string
+		want           string
+	}{
+		{12, "password", "salt", "1ae42c05d487bc02f64921a4ebe4ea93bcacfe135fda99974c06b7b01fae149a"},
+		{3, "passwordy\x00PASSWORD\x00", "salty\x00SALT\x00", "7f310bd3e78c3280c59ce4595211a2928e8d4ec744c1ed2efc9f764e3388e0ad"},
+		{8, "секретное слово", "посолить немножко", "8df43fc6fe131fc47f0c9e39224bd94c70b6fcc8ee8135faddf61156e6cb2733ea765f315a3e1e4afc35bf8687d189254c1e05a6fe80c0617f9183d67260d6a115c6c94e3603e2303fbb43a76a64523ffda686b1d4518543"},
+	}
+	for _, tt := range tests {
+		want, _ := hex.DecodeString(tt.want)
+		got, err := bcryptPBKDF([]byte(tt.password), []byte(tt.salt), tt.rounds, len(want))
+		if err != nil {
+			t.Errorf("rounds %d: %v", tt.rounds, err)
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("rounds %d: got %x, want %x", tt.rounds, got, want)
+		}
+	}
+}
+
+func TestBcryptPBKDFRejectsBadInput(t *testing.T) {
+	tests := []struct {
+		name           string
+		password, salt []byte
+		rounds, keyLen int
+	}{
+		{"no rounds", []byte("pw"), []byte("salt"), 0, 32},
+		{"empty password", nil, []byte("salt"), 16, 32},
+		{"empty salt", []byte("pw"), nil, 16, 32},
+		{"key too long", []byte("pw"), []byte("salt"), 16, 1025},
+	}
+	for _, tt := range tests {
+		if _, err := bcryptPBKDF(tt.password, tt.salt, tt.rounds, tt.keyLen); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+func TestMarshalPrivateKeyDecrypts(t *testing.T) {
+	const passphrase = "correct horse battery"
+	for name, key := range testKeys(t) {
+		for _, rounds := range []int{1, 3, 16} {
+			block, err := marshalPrivateKey(key, "test@github", passphrase, rounds)
+			if err != nil {
+				t.Fatalf("%s/%d: %v", name, rounds, err)
+			}
+			data := pem.EncodeToMemory(block)
+
+			if _, err := ssh.ParseRawPrivateKey(data); err == nil {
+				t.Errorf("%s/%d: key parsed without a passphrase", name, rounds)
+			}
+			if _, err := ssh.ParseRawPrivateKeyWithPassphrase(data, []byte("wrong")); err == nil {
+				t.Errorf("%s/%d: key parsed with the wrong passphrase", name, rounds)
+			}
+			raw, err := ssh.ParseRawPrivateKeyWithPassphrase(data, []byte(passphrase))
+			if err != nil {
+				t.Fatalf("%s/%d: %v", name, rounds, err)
+			}
+			if got, want := publicKeyOf(t, raw), publicKeyOf(t, key); got != want {
+				t.Errorf("%s/%d: decrypted key does not match", name, rounds)
+			}
+			if got := kdfRounds(t, block); got != rounds {
+				t.Errorf("%s/%d: stored %d KDF rounds", name, rounds, got)
+			}
+		}
+	}
+}
+
+func TestMarshalPrivateKeyUnencrypted(t *testing.T) {
+	for name, key := range testKeys(t) {
+		block, err := marshalPrivateKey(key, "test@github", "", 0)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		raw, err := ssh.ParseRawPrivateKey(pem.EncodeToMemory(block))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if publicKeyOf(t, raw) != publicKeyOf(t, key) {
+			t.Errorf("%s: parsed key does not match", name)
+		}
+	}
+}
+
+func TestMarshalPrivateKeyRejectsRounds(t *testing.T) {
+	key, err := newPrivateKey(keyAlgorithm{Type: "ed25519"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rounds := range []int{0, -1, maxKDFRounds + 1} {
+		if _, err := marshalPrivateKey(key, "", "passphrase", rounds); err == nil {
+			t.Errorf("rounds %d: expected an error", rounds)
+		}
+	}
+}
+
+// TestEncryptedKeyReadBySSHKeygen checks that OpenSSH itself accepts the
+// encrypted keys, when ssh-keygen is installed.
+func TestEncryptedKeyReadBySSHKeygen(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not installed")
+	}
+	const passphrase = "correct horse battery"
+	dir := t.TempDir()
+	for name, key := range testKeys(t) {
+		block, err := marshalPrivateKey(key, "test@github", passphrase, 8)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		out, err := exec.Command("ssh-keygen", "-y", "-P", passphrase, "-f", path).Output()
+		if err != nil {
+			t.Fatalf("%s: ssh-keygen: %v", name, err)
+		}
+		if got := strings.Join(strings.Fields(string(out))[:2], " "); got != publicKeyOf(t, key) {
+			t.Errorf("%s: ssh-keygen derived %s", name, got)
+		}
+	}
+}
+
+func kdfRounds(t *testing.T, block *pem.Block) int {
+	t.Helper()
+	var env openSSHKeyEnvelope
+	if err := ssh.Unmarshal(block.Bytes[len(openSSHKeyMagic):], &env); err != nil {
+		t.Fatal(err)
+	}
+	var opts struct {
+		Salt   []byte
+		Rounds uint32
+	}
+	if err := ssh.Unmarshal([]byte(env.KdfOpts), &opts); err != nil {
+		t.Fatal(err)
+	}
+	return int(opts.Rounds)
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	exportPKCS8   = "PKCS#8 private key (PEM)"
+	exportRFC4716 = "RFC 4716 public key (SSH2)"
+	exportPPK     = "PuTTY private key (PPK v3)"
+
+	ppkArgon2Memory      = 8192
+	ppkArgon2Passes      = 13
+	ppkArgon2Parallelism = 1
+)
+
+var exportFormats = []string{exportPKCS8, exportRFC4716, exportPPK}
+
+// exportFileName suggests a file name for exporting keyPath in format.
+func exportFileName(keyPath, format string) string {
+	base := keyPath[strings.LastIndexAny(keyPath, `/\`)+1:]
+	switch format {
+	case exportPKCS8:
+		return base + ".pem"
+	case exportRFC4716:
+		return base + ".ssh2.pub"
+	default:
+		return base + ".ppk"
+	}
+}
+
+// exportKey encodes key in one of exportFormats. The passphrase only applies
+// to PPK output; PKCS#8 keys are written unencrypted.
+func exportKey(key crypto.Signer, comment, format, passphrase string) ([]byte, error) {
+	switch format {
+	case exportPKCS8:
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+	case exportRFC4716:
+		pub, err := ssh.NewPublicKey(key.Public())
+		if err != nil {
+			return nil, err
+		}
+		return marshalRFC4716(pub, comment), nil
+	case exportPPK:
+		return marshalPPK(key, comment, passphrase)
+	default:
+		return nil, fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+// marshalRFC4716 encodes pub as an SSH2 public key file (RFC 4716).
+func marshalRFC4716(pub ssh.PublicKey, comment string) []byte {
+	var b bytes.Buffer
+	b.WriteString("---- BEGIN SSH2 PUBLIC KEY ----\n")
+	if comment != "" {
+		b.WriteString(fmt.Sprintf("Comment: %q\n", comment))
+	}
+	writeWrapped(&b, base64.StdEncoding.EncodeToString(pub.Marshal()), 70)
+	b.WriteString("---- END SSH2 PUBLIC KEY ----\n")
+	return b.Bytes()
+}
+
+func writeWrapped(b *bytes.Buffer, s string, width int) int {
+	lines := 0
+	for len(s) > 0 {
+		n := min(width, len(s))
+		b.WriteString(s[:n] + "\n")
+		s = s[n:]
+		lines++
+	}
+	return lines
+}
+
+// marshalPPK encodes key as a PuTTY version 3 private key file. With a
+// passphrase the private part is encrypted with aes256-cbc using an
+// Argon2id-derived key, as PuTTYgen does by default.
+func marshalPPK(key crypto.Signer, comment, passphrase string) ([]byte, error) {
+	pub, err := ssh.NewPublicKey(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	priv, err := ppkPrivateBlob(key)
+	if err != nil {
+		return nil, err
+	}
+
+	encryption := "none"
+	blockSize := 1
+	if passphrase != "" {
+		encryption = "aes256-cbc"
+		blockSize = aes.BlockSize
+	}
+	// PuTTY pads with bytes of the SHA-1 of the unpadded blob.
+	if pad := (blockSize - len(priv)%blockSize) % blockSize; pad > 0 {
+		sum := sha1.Sum(priv)
+		priv = append(priv, sum[:pad]...)
+	}
+
+	var cipherKey, iv, macKey, salt []byte
+	if passphrase != "" {
+		salt = make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		k := argon2.IDKey([]byte(passphrase), salt, ppkArgon2Passes, ppkArgon2Memory, ppkArgon2Parallelism, 32+aes.BlockSize+32)
+		cipherKey, iv, macKey = k[:32], k[32:48], k[48:]
+	}
+
+	mac := ppkMAC(sha256.New, macKey, pub.Type(), encryption, comment, pub.Marshal(), priv)
+
+	stored := priv
+	if passphrase != "" {
+		c, err := aes.NewCipher(cipherKey)
+		if err != nil {
+			return nil, err
+		}
+		stored = make([]byte, len(priv))
+		cipher.NewCBCEncrypter(c, iv).CryptBlocks(stored, priv)
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "PuTTY-User-Key-File-3: %s\n", pub.Type())
+	fmt.Fprintf(&b, "Encryption: %s\n", encryption)
+	fmt.Fprintf(&b, "Comment: %s\n", comment)
+	pubB64 := base64.StdEncoding.EncodeToString(pub.Marshal())
+	fmt.Fprintf(&b, "Public-Lines: %d\n", (len(pubB64)+63)/64)
+	writeWrapped(&b, pubB64, 64)
+	if passphrase != "" {
+		b.WriteString("Key-Derivation: Argon2id\n")
+		fmt.Fprintf(&b, "Argon2-Memory: %d\n", ppkArgon2Memory)
+		fmt.Fprintf(&b, "Argon2-Passes: %d\n", ppkArgon2Passes)
+		fmt.Fprintf(&b, "Argon2-Parallelism: %d\n", ppkArgon2Parallelism)
+		fmt.Fprintf(&b, "Argon2-Salt: %s\n", hex.EncodeToString(salt))
+	}
+	privB64 := base64.StdEncoding.EncodeToString(stored)
+	fmt.Fprintf(&b, "Private-Lines: %d\n", (len(privB64)+63)/64)
+	writeWrapped(&b, privB64, 64)
+	fmt.Fprintf(&b, "Private-MAC: %s\n", hex.EncodeToString(mac))
+	return b.Bytes(), nil
+}
+
+func ppkPrivateBlob(key crypto.Signer) ([]byte, error) {
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		// PuTTY stores the seed as an unsigned little-endian integer.
+		seed := bytes.TrimRight(k.Seed(), "\x00")
+		return ssh.Marshal(struct{ Seed []byte }{seed}), nil
+	case *rsa.PrivateKey:
+		if len(k.Primes) != 2 {
+			return nil, errors.New("multi-prime RSA keys are not supported")
+		}
+		k.Precompute()
+		return ssh.Marshal(struct {
+			D, P, Q, Iqmp *big.Int
+		}{k.D, k.Primes[0], k.Primes[1], k.Precomputed.Qinv}), nil
+	case *ecdsa.PrivateKey:
+		return ssh.Marshal(struct{ D *big.Int }{k.D}), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+}
+
+func ppkMAC(newHash func() hash.Hash, macKey []byte, algo, encryption, comment string, pub, priv []byte) []byte {
+	data := ssh.Marshal(struct {
+		Algo, Encryption, Comment string
+		Pub, Priv                 []byte
+	}{algo, encryption, comment, pub, priv})
+	m := hmac.New(newHash, macKey)
+	m.Write(data)
+	return m.Sum(nil)
+}
+
+// isPPK reports whether data looks like a PuTTY private key file.
+func isPPK(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("PuTTY-User-Key-File-"))
+}
+
+// parsePPK decodes a PuTTY private key file of version 2 or 3. An encrypted
+// file without passphrase yields an *ssh.PassphraseMissingError.
+func parsePPK(data []byte, passphrase string) (crypto.Signer, string, error) {
+	headers := map[string]string{}
+	blobs := map[string][]byte{}
+	var version int
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		line := strings.TrimRight(s.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(line, ": ")
+		if !ok {
+			return nil, "", fmt.Errorf("ppk: malformed line %q", line)
+		}
+		if strings.HasPrefix(name, "PuTTY-User-Key-File-") {
+			v, err := strconv.Atoi(strings.TrimPrefix(name, "PuTTY-User-Key-File-"))
+			if err != nil || (v != 2 && v != 3) {
+				return nil, "", fmt.Errorf("ppk: unsupported file version %q", name)
+			}
+			version = v
+			headers["Algorithm"] = value
+			continue
+		}
+		if name == "Public-Lines" || name == "Private-Lines" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 || n > 1024 {
+				return nil, "", fmt.Errorf("ppk: bad %s", name)
+			}
+			var b64 strings.Builder
+			for i := 0; i < n && s.Scan(); i++ {
+				b64.WriteString(strings.TrimSpace(s.Text()))
+			}
+			blob, err := base64.StdEncoding.DecodeString(b64.String())
+			if err != nil {
+				return nil, "", fmt.Errorf("ppk: %s: %w", name, err)
+			}
+			blobs[name] = blob
+			continue
+		}
+		headers[name] = value
+	}
+	if err := s.Err(); err != nil {
+		return nil, "", err
+	}
+	if version == 0 {
+		return nil, "", errors.New("ppk: missing PuTTY-User-Key-File header")
+	}
+	pubBlob, privBlob := blobs["Public-Lines"], blobs["Private-Lines"]
+	if pubBlob == nil || privBlob == nil {
+		return nil, "", errors.New("ppk: missing key data")
+	}
+	pub, err := ssh.ParsePublicKey(pubBlob)
+	if err != nil {
+		return nil, "", fmt.Errorf("ppk: public key: %w", err)
+	}
+	comment := headers["Comment"]
+	encryption := headers["Encryption"]
+
+	var cipherKey, iv, macKey []byte
+	newHash := sha256.New
+	switch encryption {
+	case "none":
+		if version == 2 {
+			newHash = sha1.New
+			sum := sha1.Sum([]byte("putty-private-key-file-mac-key"))
+			macKey = sum[:]
+		}
+	case "aes256-cbc":
+		if passphrase == "" {
+			return nil, "", &ssh.PassphraseMissingError{PublicKey: pub}
+		}
+		if version == 2 {
+			newHash = sha1.New
+			k0 := sha1.Sum(append([]byte{0, 0, 0, 0}, passphrase...))
+			k1 := sha1.Sum(append([]byte{0, 0, 0, 1}, passphrase...))
+			cipherKey = append(k0[:], k1[:]...)[:32]
+			iv = make([]byte, aes.BlockSize)
+			sum := sha1.Sum([]byte("putty-private-key-file-mac-key" + passphrase))
+			macKey = sum[:]
+		} else {
+			k, err := ppkArgon2(headers, passphrase)
+			if err != nil {
+				return nil, "", err
+			}
+			cipherKey, iv, macKey = k[:32], k[32:48], k[48:]
+		}
+		if len(privBlob)%aes.BlockSize != 0 {
+			return nil, "", errors.New("ppk: encrypted data is not block aligned")
+		}
+		c, err := aes.NewCipher(cipherKey)
+		if err != nil {
+			return nil, "", err
+		}
+		cipher.NewCBCDecrypter(c, iv).CryptBlocks(privBlob, privBlob)
+	default:
+		return nil, "", fmt.Errorf("ppk: unsupported encryption %q", encryption)
+	}
+
+	want, err := hex.DecodeString(headers["Private-MAC"])
+	if err != nil {
+		return nil, "", errors.New("ppk: bad Private-MAC")
+	}
+	got := ppkMAC(newHash, macKey, headers["Algorithm"], encryption, comment, pubBlob, privBlob)
+	if !hmac.Equal(got, want) {
+		if encryption != "none" {
+			return nil, "", x509.IncorrectPasswordError
+		}
+		return nil, "", errors.New("ppk: MAC check failed, file is corrupt")
+	}
+
+	key, err := ppkPrivateKey(pub, privBlob)
+	if err != nil {
+		return nil, "", err
+	}
+	return key, comment, nil
+}
+
+func ppkArgon2(headers map[string]string, passphrase string) ([]byte, error) {
+	memory, err1 := strconv.ParseUint(headers["Argon2-Memory"], 10, 32)
+	passes, err2 := strconv.ParseUint(headers["Argon2-Passes"], 10, 32)
+	parallelism, err3 := strconv.ParseUint(headers["Argon2-Parallelism"], 10, 8)
+	salt, err4 := hex.DecodeString(headers["Argon2-Salt"])
+	if err := errors.Join(err1, err2, err3, err4); err != nil {
+		return nil, fmt.Errorf("ppk: bad Argon2 parameters: %w", err)
+	}
+	// argon2 panics on zero passes or lanes, and on less than 8 KiB of
+	// memory per lane it silently raises the memory instead.
+	if passes < 1 || parallelism < 1 || parallelism > 255 || memory < 8*parallelism {
+		return nil, errors.New("ppk: Argon2 parameters are out of range")
+	}
+	if memory > 1<<22 || passes > 1<<12 {
+		return nil, errors.New("ppk: Argon2 parameters are unreasonably large")
+	}
+	const keyLen = 32 + aes.BlockSize + 32
+	switch headers["Key-Derivation"] {
+	case "Argon2id":
+		return argon2.IDKey([]byte(passphrase), salt, uint32(passes), uint32(memory), uint8(parallelism), keyLen), nil
+	case "Argon2i":
+		return argon2.Key([]byte(passphrase), salt, uint32(passes), uint32(memory), uint8(parallelism), keyLen), nil
+	default:
+		return nil, fmt.Errorf("ppk: unsupported key derivation %q", headers["Key-Derivation"])
+	}
+}
+
+func ppkPrivateKey(pub ssh.PublicKey, priv []byte) (crypto.Signer, error) {
+	cpk, ok := pub.(ssh.CryptoPublicKey)
+	if !ok {
+		return nil, fmt.Errorf("ppk: unsupported key type %s", pub.Type())
+	}
+	switch pk := cpk.CryptoPublicKey().(type) {
+	case ed25519.PublicKey:
+		var blob struct {
+			Seed []byte
+			Rest []byte `ssh:"rest"`
+		}
+		if err := ssh.Unmarshal(priv, &blob); err != nil || len(blob.Seed) > ed25519.SeedSize {
+			return nil, errors.New("ppk: malformed Ed25519 private key")
+		}
+		seed := make([]byte, ed25519.SeedSize)
+		copy(seed, blob.Seed)
+		key := ed25519.NewKeyFromSeed(seed)
+		if !bytes.Equal(key.Public().(ed25519.PublicKey), pk) {
+			return nil, errors.New("ppk: private key does not match public key")
+		}
+		return key, nil
+	case *rsa.PublicKey:
+		var blob struct {
+			D, P, Q, Iqmp *big.Int
+			Rest          []byte `ssh:"rest"`
+		}
+		if err := ssh.Unmarshal(priv, &blob); err != nil {
+			return nil, errors.New("ppk: malformed RSA private key")
+		}
+		key := &rsa.PrivateKey{PublicKey: *pk, D: blob.D, Primes: []*big.Int{blob.P, blob.Q}}
+		if err := key.Validate(); err != nil {
+			return nil, fmt.Errorf("ppk: %w", err)
+		}
+		key.Precompute()
+		return key, nil
+	case *ecdsa.PublicKey:
+		var blob struct {
+			D    *big.Int
+			Rest []byte `ssh:"rest"`
+		}
+		if err := ssh.Unmarshal(priv, &blob); err != nil {
+			return nil, errors.New("ppk: malformed ECDSA private key")
+		}
+		x, y := pk.Curve.ScalarBaseMult(blob.D.Bytes())
+		if x.Cmp(pk.X) != 0 || y.Cmp(pk.Y) != 0 {
+			return nil, errors.New("ppk: private key does not match public key")
+		}
+		return &ecdsa.PrivateKey{PublicKey: *pk, D: blob.D}, nil
+	default:
+		return nil, fmt.Errorf("ppk: unsupported key type %s", pub.Type())
+	}
+}
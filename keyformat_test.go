@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestPPKRoundTrip(t *testing.T) {
+	for name, key := range testKeys(t) {
+		for _, passphrase := range []string{"", "correct horse battery"} {
+			data, err := marshalPPK(key, "test@github", passphrase)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if !isPPK(data) || !bytes.HasPrefix(data, []byte("PuTTY-User-Key-File-3: ")) {
+				t.Fatalf("%s: not a version 3 PPK file:\n%s", name, data)
+			}
+			got, comment, err := parsePPK(data, passphrase)
+			if err != nil {
+				t.Fatalf("%s (passphrase %q): %v", name, passphrase, err)
+			}
+			if comment != "test@github" {
+				t.Errorf("%s: comment %q", name, comment)
+			}
+			if publicKeyOf(t, got) != publicKeyOf(t, key) {
+				t.Errorf("%s (passphrase %q): parsed key does not match", name, passphrase)
+			}
+		}
+	}
+}
+
+func TestPPKEd25519SeedWithTrailingZeros(t *testing.T) {
+	seed := make([]byte, ed25519.SeedSize)
+	for i := range seed[:ed25519.SeedSize-2] {
+		seed[i] = byte(i + 1)
+	}
+	key := ed25519.NewKeyFromSeed(seed)
+	data, err := marshalPPK(key, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _, err := parsePPK(data, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.(ed25519.PrivateKey), key) {
+		t.Error("seed changed in the round trip")
+	}
+}
+
+func TestParsePPKv2(t *testing.T) {
+	for name, key := range testKeys(t) {
+		for _, passphrase := range []string{"", "correct horse battery"} {
+			data := marshalPPKv2(t, key, "v2@github", passphrase)
+			got, comment, err := parsePPK(data, passphrase)
+			if err != nil {
+				t.Fatalf("%s (passphrase %q): %v", name, passphrase, err)
+			}
+			if comment != "v2@github" {
+				t.Errorf("%s: comment %q", name, comment)
+			}
+			if publicKeyOf(t, got) != publicKeyOf(t, key) {
+				t.Errorf("%s (passphrase %q): parsed key does not match", name, passphrase)
+			}
+		}
+	}
+}
+
+func TestParsePPKErrors(t *testing.T) {
+	key, err := newPrivateKey(keyAlgorithm{Type: "ed25519"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v3, err := marshalPPK(key, "c", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2 := marshalPPKv2(t, key, "c", "secret")
+	plain, err := marshalPPK(key, "c", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := func(name, value string) []byte {
+		re := regexp.MustCompile(`(?m)^` + name + `: .*$`)
+		return re.ReplaceAll(v3, []byte(name+": "+value))
+	}
+
+	tests := []struct {
+		name       string
+		data       []byte
+		passphrase string
+		check      func(error) bool
+	}{
+		{"v3 missing passphrase", v3, "", isPassphraseMissingError},
+		{"v2 missing passphrase", v2, "", isPassphraseMissingError},
+		{"v3 wrong passphrase", v3, "wrong", isIncorrectPassword},
+		{"v2 wrong passphrase", v2, "wrong", isIncorrectPassword},
+		{"zero Argon2 passes", header("Argon2-Passes", "0"), "secret", isError},
+		{"zero Argon2 parallelism", header("Argon2-Parallelism", "0"), "secret", isError},
+		{"Argon2 parallelism over 255", header("Argon2-Parallelism", "256"), "secret", isError},
+		{"Argon2 memory below 8 KiB per lane", header("Argon2-Memory", "7"), "secret", isError},
+		{"huge Argon2 memory", header("Argon2-Memory", "4294967295"), "secret", isError},
+		{"huge Argon2 passes", header("Argon2-Passes", "4294967295"), "secret", isError},
+		{"bad Argon2 salt", header("Argon2-Salt", "zz"), "secret", isError},
+		{"tampered comment", bytes.Replace(plain, []byte("Comment: c"), []byte("Comment: d"), 1), "", isError},
+		{"unsupported version", bytes.Replace(plain, []byte("File-3"), []byte("File-1"), 1), "", isError},
+		{"truncated", plain[:len(plain)/2], "", isError},
+		{"not a key", []byte("hello"), "", isError},
+	}
+	for _, tt := range tests {
+		_, _, err := parsePPK(tt.data, tt.passphrase)
+		if !tt.check(err) {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		}
+	}
+}
+
+func TestExportKey(t *testing.T) {
+	for name, key := range testKeys(t) {
+		pem8, err := exportKey(key, "test@github", exportPKCS8, "")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		block, _ := pem.Decode(pem8)
+		if block == nil || block.Type != "PRIVATE KEY" {
+			t.Fatalf("%s: not a PKCS#8 PEM block:\n%s", name, pem8)
+		}
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if publicKeyOf(t, parsed) != publicKeyOf(t, key) {
+			t.Errorf("%s: PKCS#8 key does not match", name)
+		}
+
+		ssh2, err := exportKey(key, "test@github", exportRFC4716, "")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		lines := strings.Split(strings.TrimSuffix(string(ssh2), "\n"), "\n")
+		if lines[0] != "---- BEGIN SSH2 PUBLIC KEY ----" || lines[len(lines)-1] != "---- END SSH2 PUBLIC KEY ----" || lines[1] != `Comment: "test@github"` {
+			t.Fatalf("%s: bad RFC 4716 framing:\n%s", name, ssh2)
+		}
+		var b64 string
+		for _, l := range lines[2 : len(lines)-1] {
+			if len(l) > 70 {
+				t.Errorf("%s: line longer than 70 characters", name)
+			}
+			b64 += l
+		}
+		blob, err := base64.StdEncoding.DecodeString(b64)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		pub, err := ssh.ParsePublicKey(blob)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub))) != publicKeyOf(t, key) {
+			t.Errorf("%s: RFC 4716 key does not match", name)
+		}
+	}
+}
+
+// marshalPPKv2 writes key as a PuTTY version 2 file, with the SHA-1 based
+// key derivation and MAC PuTTYgen used before version 3.
+func marshalPPKv2(t *testing.T, key crypto.Signer, comment, passphrase string) []byte {
+	t.Helper()
+	pub, err := ssh.NewPublicKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv, err := ppkPrivateBlob(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryption := "none"
+	if passphrase != "" {
+		encryption = "aes256-cbc"
+		for len(priv)%aes.BlockSize != 0 {
+			priv = append(priv, 0)
+		}
+	}
+	macData := ssh.Marshal(struct {
+		Algo, Encryption, Comment string
+		Pub, Priv                 []byte
+	}{pub.Type(), encryption, comment, pub.Marshal(), priv})
+	macKey := sha1.Sum([]byte("putty-private-key-file-mac-key" + passphrase))
+	m := hmac.New(sha1.New, macKey[:])
+	m.Write(macData)
+
+	stored := priv
+	if passphrase != "" {
+		k0 := sha1.Sum(append([]byte{0, 0, 0, 0}, passphrase...))
+		k1 := sha1.Sum(append([]byte{0, 0, 0, 1}, passphrase...))
+		c, err := aes.NewCipher(append(k0[:], k1[:]...)[:32])
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored = make([]byte, len(priv))
+		cipher.NewCBCEncrypter(c, make([]byte, aes.BlockSize)).CryptBlocks(stored, priv)
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "PuTTY-User-Key-File-2: %s\r\n", pub.Type())
+	fmt.Fprintf(&b, "Encryption: %s\r\n", encryption)
+	fmt.Fprintf(&b, "Comment: %s\r\n", comment)
+	for _, part := range []struct {
+		name string
+		data []byte
+	}{{"Public-Lines", pub.Marshal()}, {"Private-Lines", stored}} {
+		b64 := base64.StdEncoding.EncodeToString(part.data)
+		fmt.Fprintf(&b, "%s: %d\r\n", part.name, (len(b64)+63)/64)
+		for len(b64) > 0 {
+			n := min(64, len(b64))
+			b.WriteString(b64[:n] + "\r\n")
+			b64 = b64[n:]
+		}
+	}
+	fmt.Fprintf(&b, "Private-MAC: %s\r\n", hex.EncodeToString(m.Sum(nil)))
+	return b.Bytes()
+}
+
+func isPassphraseMissingError(err error) bool {
+	var missing *ssh.PassphraseMissingError
+	return errors.As(err, &missing)
+}
+
+func isIncorrectPassword(err error) bool {
+	return errors.Is(err, x509.IncorrectPasswordError)
+}
+
+func isError(err error) bool {
+	return err != nil
+}
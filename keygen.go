@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	keygenBuiltin   = "Built-in (Go)"
+	keygenSSHKeygen = "ssh-keygen"
+)
+
+// keyAlgorithm describes a key type the app can generate. Prefix is the
+// file name prefix used for keys of this type, as ssh-keygen would choose.
+type keyAlgorithm struct {
+	Name   string
+	Type   string
+	Bits   int
+	Prefix string
+}
+
+var keyAlgorithms = []keyAlgorithm{
+	{Name: "Ed25519", Type: "ed25519", Prefix: "id_ed25519"},
+	{Name: "RSA 4096", Type: "rsa", Bits: 4096, Prefix: "id_rsa"},
+	{Name: "RSA 3072", Type: "rsa", Bits: 3072, Prefix: "id_rsa"},
+	{Name: "ECDSA P-256", Type: "ecdsa", Bits: 256, Prefix: "id_ecdsa"},
+	{Name: "ECDSA P-384", Type: "ecdsa", Bits: 384, Prefix: "id_ecdsa"},
+	{Name: "ECDSA P-521", Type: "ecdsa", Bits: 521, Prefix: "id_ecdsa"},
+}
+
+// keyFilePrefixes lists the distinct file name prefixes of keyAlgorithms in
+// lookup order.
+var keyFilePrefixes = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+func keyAlgorithmNames() []string {
+	names := make([]string, 0, len(keyAlgorithms))
+	for _, algo := range keyAlgorithms {
+		names = append(names, algo.Name)
+	}
+	return names
+}
+
+// lookupKeyAlgorithm returns the algorithm with the given display name,
+// falling back to Ed25519.
+func lookupKeyAlgorithm(name string) keyAlgorithm {
+	for _, algo := range keyAlgorithms {
+		if algo.Name == name {
+			return algo
+		}
+	}
+	return keyAlgorithms[0]
+}
+
+// algorithmForPublicKey maps an existing public key onto keyAlgorithms,
+// synthesizing an entry for sizes the app does not generate itself.
+func algorithmForPublicKey(pub ssh.PublicKey) (keyAlgorithm, error) {
+	algo := keyAlgorithm{Bits: publicKeyBits(pub)}
+	switch pub.Type() {
+	case ssh.KeyAlgoED25519:
+		return keyAlgorithms[0], nil
+	case ssh.KeyAlgoRSA:
+		algo.Name, algo.Type, algo.Prefix = fmt.Sprintf("RSA %d", algo.Bits), "rsa", "id_rsa"
+	case ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521:
+		algo.Name, algo.Type, algo.Prefix = fmt.Sprintf("ECDSA P-%d", algo.Bits), "ecdsa", "id_ecdsa"
+	default:
+		return algo, fmt.Errorf("unsupported key type %s", pub.Type())
+	}
+	for _, known := range keyAlgorithms {
+		if known.Type == algo.Type && known.Bits == algo.Bits {
+			return known, nil
+		}
+	}
+	return algo, nil
+}
+
+// publicKeyBits returns the key size in bits, or 0 if it cannot be determined.
+func publicKeyBits(pub ssh.PublicKey) int {
+	cpk, ok := pub.(ssh.CryptoPublicKey)
+	if !ok {
+		return 0
+	}
+	switch k := cpk.CryptoPublicKey().(type) {
+	case *rsa.PublicKey:
+		return k.N.BitLen()
+	case *ecdsa.PublicKey:
+		return k.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		return 256
+	}
+	return 0
+}
+
+// keyOptions controls how generateKeyPair creates a key. An empty
+// Passphrase writes an unencrypted private key.
+type keyOptions struct {
+	Algorithm  keyAlgorithm
+	Backend    string
+	Passphrase string
+	KDFRounds  int
+}
+
+// keygenBackends lists the available key generation backends. The built-in
+// backend is always present; ssh-keygen is only offered when it is on PATH.
+func keygenBackends() []string {
+	backends := []string{keygenBuiltin}
+	if _, err := exec.LookPath("ssh-keygen"); err == nil {
+		backends = append(backends, keygenSSHKeygen)
+	}
+	return backends
+}
+
+func generateKeyPairBuiltin(keyPath, comment string, opts keyOptions) error {
+	priv, err := newPrivateKey(opts.Algorithm)
+	if err != nil {
+		return fmt.Errorf("%s key generation failed: %w", opts.Algorithm.Name, err)
+	}
+	return writeKeyPair(keyPath, priv, comment, opts.Passphrase, opts.KDFRounds)
+}
+
+func newPrivateKey(algo keyAlgorithm) (crypto.Signer, error) {
+	switch algo.Type {
+	case "ed25519":
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		return priv, err
+	case "rsa":
+		return rsa.GenerateKey(rand.Reader, algo.Bits)
+	case "ecdsa":
+		var curve elliptic.Curve
+		switch algo.Bits {
+		case 256:
+			curve = elliptic.P256()
+		case 384:
+			curve = elliptic.P384()
+		case 521:
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported ECDSA size %d", algo.Bits)
+		}
+		return ecdsa.GenerateKey(curve, rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", algo.Type)
+	}
+}
+
+// generateKeyPairSSHKeygen delegates key generation to the system
+// ssh-keygen. It only takes a passphrase on the command line, where other
+// local users can read it, so the key is created without one in a private
+// temporary directory and encrypted in-process by writeKeyPair.
+func generateKeyPairSSHKeygen(keyPath, comment string, opts keyOptions) error {
+	dir, err := os.MkdirTemp(filepath.Dir(keyPath), ".keygen-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	tmpKey := filepath.Join(dir, "key")
+	args := []string{"-q", "-t", opts.Algorithm.Type, "-C", comment, "-f", tmpKey, "-N", ""}
+	if opts.Algorithm.Bits > 0 {
+		args = append(args, "-b", strconv.Itoa(opts.Algorithm.Bits))
+	}
+	cmd := exec.Command("ssh-keygen", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ssh-keygen failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	data, err := os.ReadFile(tmpKey)
+	if err != nil {
+		return err
+	}
+	priv, err := parsePrivateKeyData(data, "")
+	if err != nil {
+		return fmt.Errorf("read ssh-keygen output: %w", err)
+	}
+	return writeKeyPair(keyPath, priv, comment, opts.Passphrase, opts.KDFRounds)
+}
+
+// writeKeyPair stores priv in OpenSSH private key format at keyPath and its
+// authorized_keys line at keyPath.pub. Neither file may already exist.
+func writeKeyPair(keyPath string, priv crypto.Signer, comment, passphrase string, rounds int) error {
+	block, err := marshalPrivateKey(priv, comment, passphrase, rounds)
+	if err != nil {
+		return fmt.Errorf("encode private key: %w", err)
+	}
+	pub, err := ssh.NewPublicKey(priv.Public())
+	if err != nil {
+		return fmt.Errorf("encode public key: %w", err)
+	}
+
+	if err := writeNewFile(keyPath, pem.EncodeToMemory(block), 0o600); err != nil {
+		return err
+	}
+	if err := writeNewFile(keyPath+".pub", []byte(authorizedKeyLine(pub, comment)), 0o644); err != nil {
+		_ = os.Remove(keyPath)
+		return err
+	}
+	return nil
+}
+
+// derivePublicKeyLine rebuilds the authorized_keys line of key, for private
+// keys whose .pub file has gone missing.
+func derivePublicKeyLine(key crypto.Signer, comment string) (string, error) {
+	pub, err := ssh.NewPublicKey(key.Public())
+	if err != nil {
+		return "", fmt.Errorf("encode public key: %w", err)
+	}
+	return authorizedKeyLine(pub, comment), nil
+}
+
+// writePublicKeyFile stores line at keyPath.pub, which must not exist yet.
+func writePublicKeyFile(keyPath, line string) error {
+	return writeNewFile(keyPath+".pub", []byte(line), 0o644)
+}
+
+func authorizedKeyLine(pub ssh.PublicKey, comment string) string {
+	line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub)))
+	if comment != "" {
+		line += " " + comment
+	}
+	return line + "\n"
+}
+
+// writeNewFile creates path with data, failing if it already exists. The
+// data is written to a synced temporary file first and linked into place,
+// so path never exists with partial contents. Filesystems without hard
+// links, such as FAT drives and some network mounts, fall back to an
+// exclusive create.
+func writeNewFile(path string, data []byte, perm os.FileMode) error {
+	tmp, err := writeTempFile(path, data, perm)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	if err := os.Link(tmp, path); err != nil {
+		if !linkUnsupported(err) {
+			return err
+		}
+		if err := writeNewFileDirect(path, data, perm); err != nil {
+			return err
+		}
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// linkUnsupported reports whether os.Link failed because the filesystem
+// cannot hard link, rather than because of the target.
+func linkUnsupported(err error) bool {
+	return errors.Is(err, errors.ErrUnsupported) || errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.EXDEV)
+}
+
+// writeNewFileDirect creates path exclusively and writes data to it,
+// removing the file again if the write fails.
+func writeNewFileDirect(path string, data []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+	fail := func(err error) error {
+		f.Close()
+		_ = os.Remove(path)
+		return err
+	}
+	if runtime.GOOS != "windows" {
+		if err := f.Chmod(perm); err != nil {
+			return fail(err)
+		}
+	}
+	if _, err := f.Write(data); err != nil {
+		return fail(err)
+	}
+	if err := f.Sync(); err != nil {
+		return fail(err)
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(path)
+		return err
+	}
+	return nil
+}
+
+// writeFileAtomic replaces path with data by writing a synced temporary file
+// in the same directory and renaming it over the original.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := writeTempFile(path, data, perm)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// writeTempFile writes data to a synced temporary file next to path and
+// returns its name.
+func writeTempFile(path string, data []byte, perm os.FileMode) (string, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	tmp := f.Name()
+	cleanup := func(err error) (string, error) {
+		f.Close()
+		_ = os.Remove(tmp)
+		return "", err
+	}
+	if runtime.GOOS != "windows" {
+		if err := f.Chmod(perm); err != nil {
+			return cleanup(err)
+		}
+	}
+	if _, err := f.Write(data); err != nil {
+		return cleanup(err)
+	}
+	if err := f.Sync(); err != nil {
+		return cleanup(err)
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return "", err
+	}
+	return tmp, nil
+}
+
+// syncDir flushes a directory entry change to disk. Windows cannot sync
+// directories, so it is a no-op there.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// changeKeyPassphrase re-encrypts the private key at keyPath with a new
+// passphrase, or stores it unencrypted when passphrase is empty. The file
+// keeps its permissions, which are tightened to 0600 if they were looser.
+// Unlike config writes, no backup copy is kept: it would preserve the key
+// under the passphrase, or lack of one, the user is replacing.
+func changeKeyPassphrase(keyPath string, key crypto.Signer, comment, passphrase string, rounds int) error {
+	info, err := os.Stat(keyPath)
+	if err != nil {
+		return err
+	}
+	block, err := marshalPrivateKey(key, comment, passphrase, rounds)
+	if err != nil {
+		return fmt.Errorf("encode private key: %w", err)
+	}
+	return writeFileAtomic(keyPath, pem.EncodeToMemory(block), info.Mode().Perm()&0o600)
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"crypto"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// testKeys returns one key of every supported type, keyed by a name for
+// test output. RSA uses a small size since the encoding does not depend on
+// it.
+func testKeys(t *testing.T) map[string]crypto.Signer {
+	t.Helper()
+	keys := map[string]crypto.Signer{}
+	for _, algo := range []keyAlgorithm{
+		{Type: "ed25519"},
+		{Type: "rsa", Bits: 2048},
+		{Type: "ecdsa", Bits: 256},
+		{Type: "ecdsa", Bits: 384},
+		{Type: "ecdsa", Bits: 521},
+	} {
+		key, err := newPrivateKey(algo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[fmt.Sprintf("%s-%d", algo.Type, algo.Bits)] = key
+	}
+	return keys
+}
+
+func publicKeyOf(t *testing.T, key any) string {
+	t.Helper()
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey())))
+}
+
+func TestGenerateKeyPairBuiltin(t *testing.T) {
+	dir := t.TempDir()
+	for _, algo := range keyAlgorithms {
+		if algo.Type == "rsa" && testing.Short() {
+			continue
+		}
+		keyPath := filepath.Join(dir, strings.ReplaceAll(algo.Name, " ", "_"))
+		if err := generateKeyPairBuiltin(keyPath, "test@github", keyOptions{Algorithm: algo}); err != nil {
+			t.Fatalf("%s: %v", algo.Name, err)
+		}
+
+		data, err := os.ReadFile(keyPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, err := ssh.ParseRawPrivateKey(data)
+		if err != nil {
+			t.Fatalf("%s: %v", algo.Name, err)
+		}
+		pubLine, err := os.ReadFile(keyPath + ".pub")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := publicKeyOf(t, raw) + " test@github\n"; string(pubLine) != want {
+			t.Errorf("%s: .pub is %q, want %q", algo.Name, pubLine, want)
+		}
+		pub, _, _, _, err := ssh.ParseAuthorizedKey(pubLine)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := algorithmForPublicKey(pub); err != nil || got.Name != algo.Name {
+			t.Errorf("%s: generated a %s key (%v)", algo.Name, got.Name, err)
+		}
+
+		if runtime.GOOS == "windows" {
+			continue
+		}
+		for path, want := range map[string]os.FileMode{keyPath: 0o600, keyPath + ".pub": 0o644} {
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := info.Mode().Perm(); got != want {
+				t.Errorf("%s: mode %o, want %o", filepath.Base(path), got, want)
+			}
+		}
+	}
+}
+
+func TestWriteKeyPairRefusesExistingFiles(t *testing.T) {
+	key, err := newPrivateKey(keyAlgorithms[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		existing string
+		isDir    bool
+	}{
+		{"private key exists", "", false},
+		{"public key exists", ".pub", false},
+		{"public key path is a directory", ".pub", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyPath := filepath.Join(t.TempDir(), "id_ed25519")
+			existing := keyPath + tt.existing
+			if tt.isDir {
+				err = os.Mkdir(existing, 0o700)
+			} else {
+				err = os.WriteFile(existing, []byte("keep me"), 0o600)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := writeKeyPair(keyPath, key, "", "", 0); err == nil {
+				t.Fatal("expected an error")
+			}
+			if !tt.isDir {
+				if data, _ := os.ReadFile(existing); string(data) != "keep me" {
+					t.Errorf("existing file was overwritten: %q", data)
+				}
+			}
+			if tt.existing != "" {
+				if _, err := os.Stat(keyPath); !os.IsNotExist(err) {
+					t.Errorf("private key left behind after the .pub write failed")
+				}
+			}
+			entries, _ := os.ReadDir(filepath.Dir(keyPath))
+			for _, e := range entries {
+				if strings.Contains(e.Name(), ".tmp-") {
+					t.Errorf("temporary file %s left behind", e.Name())
+				}
+			}
+		})
+	}
+}
+
+func TestLinkUnsupported(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{syscall.ENOTSUP, true},
+		{syscall.EPERM, true},
+		{syscall.EXDEV, true},
+		{syscall.EEXIST, false},
+		{syscall.ENOENT, false},
+		{syscall.EACCES, false},
+	}
+	for _, tt := range tests {
+		err := &os.LinkError{Op: "link", Old: "a", New: "b", Err: tt.err}
+		if got := linkUnsupported(err); got != tt.want {
+			t.Errorf("linkUnsupported(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestWriteNewFileDirect(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := writeNewFileDirect(path, []byte("key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "key" {
+		t.Errorf("contents %q", data)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0o600 {
+		t.Errorf("mode %o, want 600", info.Mode().Perm())
+	}
+	if err := writeNewFileDirect(path, []byte("other"), 0o600); !os.IsExist(err) {
+		t.Errorf("second write: err = %v, want it to exist", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "key" {
+		t.Errorf("existing file overwritten: %q", data)
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const severityLow = "low"
+
+// Fixes a lint finding can offer. They are limited to moving a block,
+// dropping lines that repeat earlier ones and adding IdentitiesOnly.
+const (
+	lintFixMoveToEnd       = "Move to End"
+	lintFixRemoveDuplicate = "Remove Duplicate"
+	lintFixIdentitiesOnly  = "Add IdentitiesOnly"
+)
+
+// lintFinding is a problem in an SSH config file. Line is the 1-based line
+// the problem is reported at; for fixable findings it is the Host line of
+// the block the fix applies to.
+type lintFinding struct {
+	Severity string
+	File     string
+	Line     int
+	Host     string
+	Issue    string
+	Fix      string
+}
+
+// lintSSHConfig checks configFile and the files it includes for wildcard
+// Host blocks that come before the aliases they match, Host aliases defined
+// more than once, IdentityFile paths that do not exist and Host entries
+// with an IdentityFile but no IdentitiesOnly.
+func lintSSHConfig(configFile string) ([]lintFinding, error) {
+	tree, err := configTree(configFile)
+	if err != nil {
+		return nil, err
+	}
+	homeDir := filepath.Dir(filepath.Dir(configFile))
+
+	var hosts []treeBlock
+	for _, tb := range tree {
+		if tb.Block.Header != nil && tb.Block.Header.is("host") {
+			hosts = append(hosts, tb)
+		}
+	}
+
+	var findings []lintFinding
+	for i, tb := range hosts {
+		findings = append(findings, lintWildcardOrder(tb, hosts[i+1:])...)
+	}
+	findings = append(findings, lintDuplicateHosts(hosts)...)
+	findings = append(findings, lintIdentityFiles(tree, homeDir)...)
+	findings = append(findings, lintIdentitiesOnly(tree, hosts)...)
+
+	rank := map[string]int{severityHigh: 0, severityMedium: 1, severityLow: 2}
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].Severity != findings[j].Severity {
+			return rank[findings[i].Severity] < rank[findings[j].Severity]
+		}
+		if findings[i].File != findings[j].File {
+			return findings[i].File < findings[j].File
+		}
+		return findings[i].Line < findings[j].Line
+	})
+	return findings, nil
+}
+
+// lintWildcardOrder reports a wildcard Host block that matches aliases
+// defined after it. ssh keeps the first value it finds for each option, so
+// the wildcard's options win over the specific ones.
+func lintWildcardOrder(tb treeBlock, later []treeBlock) []lintFinding {
+	h := tb.Block.Header
+	wildcard := false
+	for _, p := range h.Args {
+		if !strings.HasPrefix(p, "!") && isWildcardPattern(p) {
+			wildcard = true
+		}
+	}
+	if !wildcard {
+		return nil
+	}
+
+	opts := tb.Block.options()
+	var aliases, shadowed []string
+	for _, other := range later {
+		for _, alias := range literalPatterns(other.Block.Header.Args) {
+			if !matchPatternList(h.Args, alias) {
+				continue
+			}
+			aliases = append(aliases, alias)
+			seen := map[string]bool{}
+			for _, l := range other.Block.Lines {
+				keyword := strings.ToLower(l.Keyword)
+				if _, ok := opts[keyword]; ok && !seen[keyword] {
+					seen[keyword] = true
+					shadowed = append(shadowed, l.Keyword+" ("+alias+")")
+				}
+			}
+		}
+	}
+	if len(aliases) == 0 {
+		return nil
+	}
+
+	f := lintFinding{
+		Severity: severityLow,
+		File:     tb.File,
+		Line:     h.Line,
+		Host:     h.value(),
+		Issue:    fmt.Sprintf("Host %s comes before %s; ssh uses the first value it finds, so its options take precedence", h.value(), strings.Join(aliases, ", ")),
+	}
+	if len(shadowed) > 0 {
+		sort.Strings(shadowed)
+		f.Severity = severityMedium
+		f.Issue += "; it overrides " + strings.Join(shadowed, ", ")
+	}
+	if tb.Parent == nil {
+		f.Fix = lintFixMoveToEnd
+	}
+	return []lintFinding{f}
+}
+
+// lintDuplicateHosts reports aliases listed by more than one Host block.
+// The fix is offered when the later block only repeats lines of the first,
+// so removing it changes nothing.
+func lintDuplicateHosts(hosts []treeBlock) []lintFinding {
+	first := map[string]treeBlock{}
+	var findings []lintFinding
+	for _, tb := range hosts {
+		for _, alias := range literalPatterns(tb.Block.Header.Args) {
+			key := strings.ToLower(alias)
+			orig, ok := first[key]
+			if !ok {
+				first[key] = tb
+				continue
+			}
+			f := lintFinding{
+				Severity: severityMedium,
+				File:     tb.File,
+				Line:     tb.Block.Header.Line,
+				Host:     alias,
+				Issue:    fmt.Sprintf("Host %s is already defined at %s:%d; options set there take precedence", alias, orig.File, orig.Block.Header.Line),
+			}
+			if tb.Parent == nil && repeatsBlock(tb.Block, orig.Block) {
+				f.Fix = lintFixRemoveDuplicate
+			}
+			findings = append(findings, f)
+		}
+	}
+	return findings
+}
+
+// lintIdentityFiles reports IdentityFile lines naming files that do not
+// exist. Paths using ssh's % tokens are skipped since they depend on the
+// connection.
+func lintIdentityFiles(tree []treeBlock, homeDir string) []lintFinding {
+	var findings []lintFinding
+	for _, tb := range tree {
+		for _, l := range tb.Block.Lines {
+			if !l.is("identityfile") || len(l.Args) == 0 {
+				continue
+			}
+			path := l.Args[0]
+			if strings.EqualFold(path, "none") || strings.Contains(path, "%") {
+				continue
+			}
+			if _, err := os.Stat(expandHome(path, homeDir)); err == nil {
+				continue
+			}
+			host := ""
+			if tb.Block.Header != nil {
+				host = tb.Block.Header.value()
+			}
+			findings = append(findings, lintFinding{
+				Severity: severityHigh,
+				File:     tb.File,
+				Line:     l.Line,
+				Host:     host,
+				Issue:    "IdentityFile " + path + " does not exist",
+			})
+		}
+	}
+	return findings
+}
+
+// lintIdentitiesOnly reports Host entries that set an IdentityFile without
+// an IdentitiesOnly setting applying to them, from their own block, a
+// matching wildcard block or the global section. Without it ssh offers the
+// agent's keys first, and GitHub picks the account of whichever key it sees
+// first.
+func lintIdentitiesOnly(tree, hosts []treeBlock) []lintFinding {
+	var findings []lintFinding
+	for _, tb := range hosts {
+		if tb.Block.option("identityfile") == nil {
+			continue
+		}
+		for _, alias := range literalPatterns(tb.Block.Header.Args) {
+			set := false
+			for _, other := range tree {
+				h := other.Block.Header
+				applies := (h == nil && other.Parent == nil) || (h != nil && h.is("host") && matchPatternList(h.Args, alias))
+				if applies && other.Block.option("identitiesonly") != nil {
+					set = true
+					break
+				}
+			}
+			if set {
+				continue
+			}
+			f := lintFinding{
+				Severity: severityMedium,
+				File:     tb.File,
+				Line:     tb.Block.Header.Line,
+				Host:     alias,
+				Issue:    "Host " + alias + " sets IdentityFile without IdentitiesOnly yes; ssh may offer other keys first and log in as the wrong GitHub account",
+			}
+			if tb.Parent == nil {
+				f.Fix = lintFixIdentitiesOnly
+			}
+			findings = append(findings, f)
+			break
+		}
+	}
+	return findings
+}
+
+// applyLintFix returns config, the contents of f.File, with f's fix applied.
+func applyLintFix(config []byte, f lintFinding) ([]byte, error) {
+	cfg := parseSSHConfig(config)
+	idx := -1
+	for i, b := range cfg.Blocks {
+		if b.Header.Line == f.Line && b.Header.is("host") {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return nil, fmt.Errorf("no Host entry at %s:%d; run the linter again", f.File, f.Line)
+	}
+
+	switch f.Fix {
+	case lintFixMoveToEnd:
+		// Comments directly above the Host line describe the block and
+		// move with it.
+		prev := cfg.Global
+		if idx > 0 {
+			prev = cfg.Blocks[idx-1]
+		}
+		lead := prev.takeTrailingComments()
+		atTop := len(prev.Lines) == 0
+		_, b := cfg.detachBlock(idx)
+		if atTop {
+			// The blank line that separated the block from the next one
+			// would otherwise start the file.
+			for len(prev.Lines) > 0 && prev.Lines[0].Keyword == "" && strings.TrimSpace(prev.Lines[0].raw) == "" {
+				prev.Lines = prev.Lines[1:]
+			}
+		}
+		cfg.addBlock(b)
+		before := cfg.Global
+		if len(cfg.Blocks) > 1 {
+			before = cfg.Blocks[len(cfg.Blocks)-2]
+		}
+		before.Lines = append(before.Lines, lead...)
+	case lintFixRemoveDuplicate:
+		cfg.removeHostAt(idx, f.Host)
+	case lintFixIdentitiesOnly:
+		cfg.Blocks[idx].appendOption("IdentitiesOnly yes", cfg.newline)
+	default:
+		return nil, fmt.Errorf("no automatic fix for: %s", f.Issue)
+	}
+	return cfg.Bytes(), nil
+}
+
+// literalPatterns returns the patterns of a Host line that name a single
+// host.
+func literalPatterns(patterns []string) []string {
+	var out []string
+	for _, p := range patterns {
+		if !strings.HasPrefix(p, "!") && !isWildcardPattern(p) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// repeatsBlock reports whether every option line of b also appears in orig.
+func repeatsBlock(b, orig *configBlock) bool {
+	have := map[string]bool{}
+	for _, l := range orig.Lines {
+		if l.Keyword != "" {
+			have[strings.ToLower(renderConfigOption(l.Keyword, l.Args))] = true
+		}
+	}
+	for _, l := range b.Lines {
+		if l.Keyword != "" && !have[strings.ToLower(renderConfigOption(l.Keyword, l.Args))] {
+			return false
+		}
+	}
+	return true
+}
+
+func lintSummary(findings []lintFinding) string {
+	high := 0
+	for _, f := range findings {
+		if f.Severity == severityHigh {
+			high++
+		}
+	}
+	return fmt.Sprintf("%d finding(s), %d high severity", len(findings), high)
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// lintFixture writes config and files, relative to ~/.ssh, into a new home
+// directory with an existing key ~/.ssh/id_work, and returns the config
+// path.
+func lintFixture(t *testing.T, config string, files map[string]string) string {
+	t.Helper()
+	sshDir := filepath.Join(t.TempDir(), ".ssh")
+	files["config"] = config
+	files["id_work"] = "key"
+	for rel, data := range files {
+		path := filepath.Join(sshDir, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return filepath.Join(sshDir, "config")
+}
+
+func TestLintSSHConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		files  map[string]string
+		want   []string
+	}{
+		{
+			"clean",
+			"Host gh\n  IdentityFile ~/.ssh/id_work\n  IdentitiesOnly yes\n\nHost *\n  User git\n",
+			nil,
+			nil,
+		},
+		{
+			"wildcard first without overrides",
+			"Host *\n  ServerAliveInterval 60\n\nHost gh\n  User git\n",
+			nil,
+			[]string{"low config:1 * Move to End"},
+		},
+		{
+			"wildcard first overriding an option",
+			"Host gh*\n  User nobody\n\nHost gh\n  User git\n\nHost other\n  User x\n",
+			nil,
+			[]string{"medium config:1 gh* Move to End"},
+		},
+		{
+			"negated pattern excludes the alias",
+			"Host * !gh\n  User nobody\n\nHost gh\n  User git\n",
+			nil,
+			nil,
+		},
+		{
+			"duplicate repeating the first",
+			"Host gh\n  User git\n\nHost gh\n  user git\n",
+			nil,
+			[]string{"medium config:4 gh Remove Duplicate"},
+		},
+		{
+			"duplicate with other options",
+			"Host gh\n  User git\n\nHost GH\n  Port 443\n",
+			nil,
+			[]string{"medium config:4 GH "},
+		},
+		{
+			"missing IdentityFile",
+			"IdentitiesOnly yes\n\nHost gh\n  IdentityFile ~/.ssh/missing\n  IdentityFile ~/.ssh/%r\n  IdentityFile none\n",
+			nil,
+			[]string{"high config:4 gh "},
+		},
+		{
+			"IdentityFile without IdentitiesOnly",
+			"Host gh other\n  IdentityFile ~/.ssh/id_work\n",
+			nil,
+			[]string{"medium config:1 gh Add IdentitiesOnly"},
+		},
+		{
+			"IdentitiesOnly from a wildcard block",
+			"Host gh\n  IdentityFile ~/.ssh/id_work\n\nHost g*\n  IdentitiesOnly yes\n",
+			nil,
+			nil,
+		},
+		{
+			"findings in an included file",
+			"Include config.d/*\n\nHost gh\n  User git\n",
+			map[string]string{"config.d/a.conf": "Host gh\n  User git\n\nHost work\n  IdentityFile ~/.ssh/id_work\n"},
+			[]string{"medium config:3 gh Remove Duplicate", "medium a.conf:4 work Add IdentitiesOnly"},
+		},
+		{
+			"Host inside an Include under a Host block",
+			"Host gh\n  Include extra\n\nHost gh-work\n  User git\n",
+			map[string]string{"extra": "Host gh-*\n  User nobody\n"},
+			[]string{"medium extra:1 gh-* "},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.files == nil {
+				tt.files = map[string]string{}
+			}
+			findings, err := lintSSHConfig(lintFixture(t, tt.config, tt.files))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, f := range findings {
+				got = append(got, fmt.Sprintf("%s %s:%d %s %s", f.Severity, filepath.Base(f.File), f.Line, f.Host, f.Fix))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got  %q\nwant %q", got, tt.want)
+				for _, f := range findings {
+					t.Log(f.Issue)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyLintFix(t *testing.T) {
+	tests := []struct {
+		name, config, fix, want string
+	}{
+		{
+			"move wildcard to end with its comment",
+			"# defaults\nHost *\n  User nobody\n\n# work\nHost gh\n  User git\n",
+			lintFixMoveToEnd,
+			"# work\nHost gh\n  User git\n\n# defaults\nHost *\n  User nobody\n",
+		},
+		{
+			"move wildcard to end of a file without final newline",
+			"Host *\r\n  User nobody\r\n\r\nHost gh\r\n  User git",
+			lintFixMoveToEnd,
+			"Host gh\r\n  User git\r\n\r\nHost *\r\n  User nobody\r\n",
+		},
+		{
+			"remove duplicate block",
+			"Host gh\n  User git\n\nHost gh\n  User git\n\nHost other\n  User x\n",
+			lintFixRemoveDuplicate,
+			"Host gh\n  User git\n\nHost other\n  User x\n",
+		},
+		{
+			"remove duplicate alias from a shared Host line",
+			"Host gh\n  User git\n\nHost other gh\n  User git\n",
+			lintFixRemoveDuplicate,
+			"Host gh\n  User git\n\nHost other\n  User git\n",
+		},
+		{
+			"add IdentitiesOnly",
+			"Host gh\n  IdentityFile ~/.ssh/id_work\n\n# next\nHost other\n  User x\n",
+			lintFixIdentitiesOnly,
+			"Host gh\n  IdentityFile ~/.ssh/id_work\n  IdentitiesOnly yes\n\n# next\nHost other\n  User x\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configFile := lintFixture(t, tt.config, map[string]string{})
+			findings, err := lintSSHConfig(configFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var fixes []lintFinding
+			for _, f := range findings {
+				if f.Fix != "" {
+					fixes = append(fixes, f)
+				}
+			}
+			if len(fixes) != 1 || fixes[0].Fix != tt.fix {
+				t.Fatalf("fixable findings %+v, want one %s", fixes, tt.fix)
+			}
+			out, err := applyLintFix([]byte(tt.config), fixes[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got  %q\nwant %q", out, tt.want)
+			}
+			if again, _ := lintSSHConfig(lintFixture(t, string(out), map[string]string{})); len(again) != 0 {
+				t.Errorf("fixed config still has findings: %+v", again)
+			}
+		})
+	}
+}
+
+func TestApplyLintFixStale(t *testing.T) {
+	f := lintFinding{File: "config", Line: 1, Host: "gh", Fix: lintFixMoveToEnd}
+	if _, err := applyLintFix([]byte("# moved\nHost gh\n"), f); err == nil {
+		t.Error("expected an error for a finding that no longer matches the file")
+	}
+	f = lintFinding{Line: 1, Host: "gh", Issue: "IdentityFile missing"}
+	if _, err := applyLintFix([]byte("Host gh\n"), f); err == nil {
+		t.Error("expected an error for a finding without a fix")
+	}
+}
@@ -9,7 +9,7 @@ import (
 )
 
 func main() {
-	a := app.New()
+	a := app.NewWithID("com.sarwarhridoy4.github-ssh-manager")
 	w := a.NewWindow("GitHub SSH Manager")
 	w.Resize(fyne.NewSize(980, 760))
 
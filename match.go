@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// matchExecTimeout bounds how long a Match exec command may run.
+const matchExecTimeout = 5 * time.Second
+
+// matchCriteriaWithArg are the Match criteria that take an argument.
+var matchCriteriaWithArg = map[string]bool{
+	"host":         true,
+	"originalhost": true,
+	"user":         true,
+	"localuser":    true,
+	"exec":         true,
+}
+
+// matchCriterion is one condition of a Match line, such as
+// "host github.com" or "!exec test-vpn".
+type matchCriterion struct {
+	Name    string
+	Negated bool
+	Arg     string
+}
+
+// parseMatchCriteria splits the arguments of a Match line into criteria.
+// Only all, host, originalhost, user, localuser and exec are accepted.
+func parseMatchCriteria(args []string) ([]matchCriterion, error) {
+	var criteria []matchCriterion
+	for i := 0; i < len(args); i++ {
+		name, negated := strings.CutPrefix(strings.ToLower(args[i]), "!")
+		c := matchCriterion{Name: name, Negated: negated}
+		switch {
+		case name == "all":
+			if len(args) > 1 {
+				return nil, fmt.Errorf("Match all cannot be combined with other criteria")
+			}
+		case matchCriteriaWithArg[name]:
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("Match %s needs an argument", name)
+			}
+			i++
+			c.Arg = args[i]
+		default:
+			return nil, fmt.Errorf("unsupported Match criterion %q", args[i])
+		}
+		criteria = append(criteria, c)
+	}
+	if len(criteria) == 0 {
+		return nil, fmt.Errorf("Match needs at least one criterion")
+	}
+	return criteria, nil
+}
+
+// matchContext is what Match criteria are tested against: the alias typed
+// on the command line, the HostName and User known so far, and the local
+// user. exec runs a Match exec command and reports whether it succeeded.
+type matchContext struct {
+	Alias     string
+	HostName  string
+	User      string
+	LocalUser string
+	HomeDir   string
+	exec      func(command string) bool
+}
+
+// matchApplies evaluates the criteria of a Match line. All criteria must
+// hold, and a criterion prefixed with '!' is negated. ok is false when the
+// line uses a criterion that is not supported.
+func matchApplies(args []string, mc matchContext) (applies, ok bool) {
+	criteria, err := parseMatchCriteria(args)
+	if err != nil {
+		return false, false
+	}
+	for _, c := range criteria {
+		var result bool
+		switch c.Name {
+		case "all":
+			result = true
+		case "host":
+			result = matchPatternList(strings.Split(c.Arg, ","), strings.ToLower(mc.HostName))
+		case "originalhost":
+			result = matchPatternList(strings.Split(c.Arg, ","), strings.ToLower(mc.Alias))
+		case "user":
+			result = matchPatternList(strings.Split(c.Arg, ","), mc.User)
+		case "localuser":
+			result = matchPatternList(strings.Split(c.Arg, ","), mc.LocalUser)
+		case "exec":
+			result = mc.exec != nil && mc.exec(expandMatchTokens(c.Arg, mc))
+		}
+		if result == c.Negated {
+			return false, true
+		}
+	}
+	return true, true
+}
+
+// expandMatchTokens replaces the % tokens ssh allows in Match exec commands.
+func expandMatchTokens(s string, mc matchContext) string {
+	return strings.NewReplacer(
+		"%%", "%",
+		"%h", mc.HostName,
+		"%n", mc.Alias,
+		"%r", mc.User,
+		"%u", mc.LocalUser,
+		"%d", mc.HomeDir,
+	).Replace(s)
+}
+
+// runMatchExec runs a Match exec command through the shell, as ssh does,
+// and reports whether it exited successfully.
+func runMatchExec(command string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), matchExecTimeout)
+	defer cancel()
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	}
+	return cmd.Run() == nil
+}
+
+// headerAliases returns the host aliases a Host or Match line names
+// literally. For Match these are the plain patterns of its host and
+// originalhost criteria.
+func headerAliases(h *configLine) []string {
+	if h.is("host") {
+		return literalPatterns(h.Args)
+	}
+	if !h.is("match") {
+		return nil
+	}
+	criteria, err := parseMatchCriteria(h.Args)
+	if err != nil {
+		return nil
+	}
+	var aliases []string
+	for _, c := range criteria {
+		if !c.Negated && (c.Name == "host" || c.Name == "originalhost") {
+			aliases = append(aliases, literalPatterns(strings.Split(c.Arg, ","))...)
+		}
+	}
+	return aliases
+}
+
+// definesAlias reports whether a Host or Match line names alias.
+func definesAlias(h *configLine, alias string) bool {
+	return containsFold(headerAliases(h), alias)
+}
+
+// matchHeader builds the header of a Match block that applies to alias
+// under the extra criteria in condition, e.g. `exec "on-office-network"`.
+func matchHeader(alias, condition string) (string, error) {
+	args := splitConfigArgs(condition)
+	criteria, err := parseMatchCriteria(args)
+	if err != nil {
+		return "", err
+	}
+	for _, c := range criteria {
+		if c.Name == "all" {
+			return "", fmt.Errorf("Match all would apply to every host, not just %s", alias)
+		}
+	}
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = quoteConfigArg(a)
+	}
+	return "Match originalhost " + alias + " " + strings.Join(quoted, " "), nil
+}
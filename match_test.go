@@ -0,0 +1,128 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMatchCriteria(t *testing.T) {
+	tests := []struct {
+		args []string
+		want []matchCriterion
+		ok   bool
+	}{
+		{[]string{"all"}, []matchCriterion{{Name: "all"}}, true},
+		{[]string{"Host", "gh,*.example.com", "!exec", "test -f x"}, []matchCriterion{
+			{Name: "host", Arg: "gh,*.example.com"},
+			{Name: "exec", Negated: true, Arg: "test -f x"},
+		}, true},
+		{[]string{"originalhost", "gh", "user", "git", "localuser", "me"}, []matchCriterion{
+			{Name: "originalhost", Arg: "gh"},
+			{Name: "user", Arg: "git"},
+			{Name: "localuser", Arg: "me"},
+		}, true},
+		{nil, nil, false},
+		{[]string{"all", "host", "gh"}, nil, false},
+		{[]string{"host"}, nil, false},
+		{[]string{"canonical"}, nil, false},
+		{[]string{"tagged", "work"}, nil, false},
+	}
+	for _, tt := range tests {
+		got, err := parseMatchCriteria(tt.args)
+		if (err == nil) != tt.ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseMatchCriteria(%q) = %+v, %v; want %+v, ok %v", tt.args, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestMatchApplies(t *testing.T) {
+	mc := matchContext{
+		Alias:     "gh-work",
+		HostName:  "github.com",
+		User:      "git",
+		LocalUser: "alice",
+		HomeDir:   "/home/alice",
+		exec: func(command string) bool {
+			return command == "on-vpn github.com gh-work git alice /home/alice %h"
+		},
+	}
+	tests := []struct {
+		args        []string
+		applies, ok bool
+	}{
+		{[]string{"all"}, true, true},
+		{[]string{"host", "github.com"}, true, true},
+		{[]string{"host", "GitHub.com"}, true, true},
+		{[]string{"host", "gh-work"}, false, true},
+		{[]string{"host", "gitlab.com,*.github.com,github.*"}, true, true},
+		{[]string{"host", "*,!github.com"}, false, true},
+		{[]string{"!host", "github.com"}, false, true},
+		{[]string{"originalhost", "gh-*"}, true, true},
+		{[]string{"originalhost", "github.com"}, false, true},
+		{[]string{"user", "git"}, true, true},
+		{[]string{"user", "alice"}, false, true},
+		{[]string{"localuser", "alice"}, true, true},
+		{[]string{"!localuser", "alice"}, false, true},
+		{[]string{"exec", "on-vpn %h %n %r %u %d %%h"}, true, true},
+		{[]string{"exec", "on-vpn"}, false, true},
+		{[]string{"!exec", "on-vpn"}, true, true},
+		{[]string{"originalhost", "gh-work", "user", "git", "exec", "on-vpn %h %n %r %u %d %%h"}, true, true},
+		{[]string{"originalhost", "gh-work", "user", "nobody"}, false, true},
+		{[]string{"canonical"}, false, false},
+		{[]string{"host", "github.com", "final"}, false, false},
+		{[]string{"host"}, false, false},
+	}
+	for _, tt := range tests {
+		applies, ok := matchApplies(tt.args, mc)
+		if applies != tt.applies || ok != tt.ok {
+			t.Errorf("matchApplies(%q) = %v, %v; want %v, %v", tt.args, applies, ok, tt.applies, tt.ok)
+		}
+	}
+
+	if applies, _ := matchApplies([]string{"exec", "true"}, matchContext{}); applies {
+		t.Error("Match exec applied without a way to run commands")
+	}
+}
+
+func TestMatchHeader(t *testing.T) {
+	tests := []struct {
+		condition, want string
+		ok              bool
+	}{
+		{`exec "on-office-network"`, "Match originalhost gh exec on-office-network", true},
+		{`exec "test -f ~/.vpn"`, `Match originalhost gh exec "test -f ~/.vpn"`, true},
+		{"localuser alice !exec on-vpn", "Match originalhost gh localuser alice !exec on-vpn", true},
+		{"all", "", false},
+		{"", "", false},
+		{"exec", "", false},
+		{"canonical", "", false},
+	}
+	for _, tt := range tests {
+		got, err := matchHeader("gh", tt.condition)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("matchHeader(%q) = %q, %v; want %q, ok %v", tt.condition, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestHeaderAliases(t *testing.T) {
+	tests := []struct {
+		header string
+		want   []string
+	}{
+		{"Host gh gh-* !bad other", []string{"gh", "other"}},
+		{"Match originalhost gh,gh-* exec on-vpn", []string{"gh"}},
+		{"Match host github.com !originalhost gh", []string{"github.com"}},
+		{"Match all", nil},
+		{"Match canonical", nil},
+		{"Include gh", nil},
+	}
+	for _, tt := range tests {
+		if got := headerAliases(parseConfigLine(tt.header)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("headerAliases(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+	if h := parseConfigLine("Match originalhost GH exec on-vpn"); !definesAlias(h, "gh") || definesAlias(h, "other") {
+		t.Error("definesAlias does not follow the Match line's aliases")
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// removalPlan lists everything a Remove Account run will change so it can be
+// shown to the user before anything is touched.
+type removalPlan struct {
+	Label        string
+	Alias        string
+	KeyPath      string
+	PublicKey    string
+	ConfigBlock  string
+	DeleteGitHub bool
+}
+
+func planAccountRemoval(sshDir, configFile, label, alias string, deleteGitHub bool) (*removalPlan, error) {
+	plan := &removalPlan{Label: label, Alias: alias, DeleteGitHub: deleteGitHub}
+	if keyPath, ok := findKeyBasePath(sshDir, label); ok {
+		plan.KeyPath = keyPath
+		if pub, err := os.ReadFile(keyPath + ".pub"); err == nil {
+			plan.PublicKey = strings.TrimSpace(string(pub))
+		}
+	}
+	if config, err := os.ReadFile(configFile); err == nil {
+		if _, removed, err := removeHostAlias(config, alias); err == nil {
+			plan.ConfigBlock = removed
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if plan.KeyPath == "" && plan.ConfigBlock == "" {
+		return nil, fmt.Errorf("nothing to remove: no key for %s and no Host entry for %s", label, alias)
+	}
+	if deleteGitHub && plan.PublicKey == "" {
+		return nil, errors.New("cannot delete from GitHub: public key not found locally")
+	}
+	return plan, nil
+}
+
+func (p *removalPlan) summary() string {
+	var b strings.Builder
+	if p.KeyPath != "" {
+		fmt.Fprintf(&b, "Archive key pair:\n  %s\n  %s.pub\n\n", p.KeyPath, p.KeyPath)
+	} else {
+		fmt.Fprintf(&b, "No key found for label %s.\n\n", p.Label)
+	}
+	if p.ConfigBlock != "" {
+		fmt.Fprintf(&b, "Remove from SSH config:\n%s\n\n", strings.TrimRight(p.ConfigBlock, "\n"))
+	} else {
+		fmt.Fprintf(&b, "No Host entry for %s in SSH config.\n\n", p.Alias)
+	}
+	if p.DeleteGitHub {
+		b.WriteString("Delete the matching key from your GitHub account.\n")
+	}
+	return b.String()
+}
+
+// executeAccountRemoval applies plan. The GitHub deletion runs first so a
+// failing API call leaves the local files untouched.
+func executeAccountRemoval(plan *removalPlan, sshDir, configFile, token string, progress func(string)) (string, error) {
+	if plan.DeleteGitHub {
+		key, err := findGitHubKey(token, plan.PublicKey)
+		if err != nil {
+			return "", fmt.Errorf("look up key on GitHub: %w", err)
+		}
+		if key == nil {
+			progress("Key was not found on GitHub; nothing to delete")
+		} else {
+			if err := deleteGitHubKey(token, key.ID); err != nil {
+				return "", fmt.Errorf("delete key from GitHub: %w", err)
+			}
+			progress(fmt.Sprintf("Key deleted from GitHub (ID: %d)", key.ID))
+		}
+	}
+
+	if plan.ConfigBlock != "" {
+		backup, _, err := removeHostFromConfig(sshDir, configFile, plan.Alias)
+		if err != nil {
+			return "", fmt.Errorf("update SSH config: %w", err)
+		}
+		progress("Host " + plan.Alias + " removed from SSH config (backup: " + backup + ")")
+	}
+
+	archiveDir := ""
+	if plan.KeyPath != "" {
+		dir, err := archiveKeyFiles(sshDir, plan.KeyPath)
+		if err != nil {
+			return "", fmt.Errorf("archive key: %w", err)
+		}
+		archiveDir = dir
+		progress("Key pair archived to " + archiveDir)
+	}
+	return archiveDir, nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// multiValueKeywords are options where every value found is used, in order,
+// instead of only the first one.
+var multiValueKeywords = map[string]bool{
+	"identityfile":    true,
+	"certificatefile": true,
+	"localforward":    true,
+	"remoteforward":   true,
+	"dynamicforward":  true,
+	"sendenv":         true,
+	"setenv":          true,
+}
+
+// pathKeywords are options naming files, shown with "~" expanded.
+var pathKeywords = map[string]bool{
+	"identityfile":         true,
+	"certificatefile":      true,
+	"userknownhostsfile":   true,
+	"globalknownhostsfile": true,
+	"identityagent":        true,
+	"controlpath":          true,
+}
+
+// resolvedOption is an effective setting and the line it came from. File is
+// empty for ssh's built-in defaults.
+type resolvedOption struct {
+	Keyword string
+	Value   string
+	File    string
+	Line    int
+}
+
+// resolvedConfig is the outcome of resolveHostConfig. Applied holds the
+// blocks that matched, in the order ssh reads them; Skipped holds Match
+// blocks with criteria that are not supported.
+type resolvedConfig struct {
+	Alias   string
+	Options []resolvedOption
+	Applied []treeBlock
+	Skipped []treeBlock
+}
+
+// resolveHostConfig works out the options ssh uses to connect to alias, like
+// `ssh -G alias`. Blocks are read in order, following Include, and the first
+// value found for each option wins. Match exec commands are run with
+// runExec. HostName, User and Port fall back to ssh's defaults when nothing
+// sets them.
+func resolveHostConfig(configFile, alias string, runExec func(string) bool) (*resolvedConfig, error) {
+	tree, err := configTree(configFile)
+	if err != nil {
+		return nil, err
+	}
+	homeDir := filepath.Dir(filepath.Dir(configFile))
+	res := &resolvedConfig{Alias: alias}
+	first := map[string]resolvedOption{}
+	localUser := localUsername()
+
+	// A file included under a Host or Match line is only read when that
+	// line applied, so blocks remember whether their header did.
+	active := map[*configLine]bool{}
+	unknown := map[*configLine]bool{}
+	for _, tb := range tree {
+		header := tb.Block.Header
+		if tb.Parent != nil && unknown[tb.Parent] {
+			if header != nil {
+				unknown[header] = true
+			}
+			res.Skipped = append(res.Skipped, tb)
+			continue
+		}
+		if tb.Parent != nil && !active[tb.Parent] {
+			continue
+		}
+		mc := matchContext{Alias: alias, HostName: alias, User: localUser, LocalUser: localUser, HomeDir: homeDir, exec: runExec}
+		if opt, ok := first["hostname"]; ok {
+			mc.HostName = expandHostName(opt.Value, alias)
+		}
+		if opt, ok := first["user"]; ok {
+			mc.User = opt.Value
+		}
+		applies, ok := headerApplies(header, mc)
+		if !ok {
+			unknown[header] = true
+			res.Skipped = append(res.Skipped, tb)
+			continue
+		}
+		if !applies {
+			continue
+		}
+		if header != nil {
+			active[header] = true
+		}
+		res.Applied = append(res.Applied, tb)
+		for _, l := range tb.Block.Lines {
+			if l.Keyword == "" || len(l.Args) == 0 || l.is("include") {
+				continue
+			}
+			key := strings.ToLower(l.Keyword)
+			if _, seen := first[key]; seen && !multiValueKeywords[key] {
+				continue
+			}
+			value := l.value()
+			if pathKeywords[key] {
+				value = expandHome(value, homeDir)
+			}
+			opt := resolvedOption{Keyword: key, Value: value, File: tb.File, Line: l.Line}
+			if _, seen := first[key]; !seen {
+				first[key] = opt
+			}
+			res.Options = append(res.Options, opt)
+		}
+	}
+
+	if opt, ok := first["hostname"]; ok {
+		for i := range res.Options {
+			if res.Options[i].Keyword == "hostname" {
+				res.Options[i].Value = expandHostName(opt.Value, alias)
+			}
+		}
+	} else {
+		res.Options = append(res.Options, resolvedOption{Keyword: "hostname", Value: alias})
+	}
+	if _, ok := first["user"]; !ok {
+		res.Options = append(res.Options, resolvedOption{Keyword: "user", Value: localUser})
+	}
+	if _, ok := first["port"]; !ok {
+		res.Options = append(res.Options, resolvedOption{Keyword: "port", Value: "22"})
+	}
+	sort.SliceStable(res.Options, func(i, j int) bool { return res.Options[i].Keyword < res.Options[j].Keyword })
+	return res, nil
+}
+
+// headerApplies reports whether a block headed by h is used for the
+// connection described by mc. A nil header is the top level of a file.
+// ok is false for Match lines that cannot be evaluated.
+func headerApplies(h *configLine, mc matchContext) (applies, ok bool) {
+	switch {
+	case h == nil:
+		return true, true
+	case h.is("host"):
+		return matchPatternList(h.Args, strings.ToLower(mc.Alias)), true
+	case h.is("match"):
+		return matchApplies(h.Args, mc)
+	}
+	return false, false
+}
+
+// expandHostName replaces the %h and %% tokens ssh allows in HostName.
+func expandHostName(value, alias string) string {
+	return strings.NewReplacer("%h", alias, "%%", "%").Replace(value)
+}
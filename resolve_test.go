@@ -0,0 +1,181 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestResolveHostConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		files   map[string]string
+		alias   string
+		exec    map[string]bool
+		want    []string
+		skipped int
+	}{
+		{
+			"first value wins",
+			"Host gh\n  HostName github.com\n  User git\n\nHost *\n  User nobody\n  Port 2222\n",
+			nil,
+			"gh",
+			nil,
+			[]string{"hostname github.com", "port 2222", "user git"},
+			0,
+		},
+		{
+			"defaults",
+			"Host other\n  User x\n",
+			nil,
+			"gh",
+			nil,
+			[]string{"hostname gh", "port 22", "user " + localUsername()},
+			0,
+		},
+		{
+			"multi-value options and HostName tokens",
+			"Host gh*\n  HostName %h.example.com\n  User git\n  IdentityFile ~/.ssh/a\n\nHost *\n  IdentityFile ~/.ssh/b\n",
+			nil,
+			"gh1",
+			nil,
+			[]string{"hostname gh1.example.com", "identityfile ~/.ssh/a", "identityfile ~/.ssh/b", "port 22", "user git"},
+			0,
+		},
+		{
+			"Match host sees the HostName set earlier",
+			"Host gh\n  HostName github.com\n\nMatch host github.com user git\n  Port 443\n\nMatch user git\n  User set-too-late\n\nHost *\n  User git\n",
+			nil,
+			"gh",
+			nil,
+			[]string{"hostname github.com", "port 22", "user git"},
+			0,
+		},
+		{
+			"Match exec",
+			"Match originalhost gh exec \"on-vpn %n\"\n  User work\n\nMatch exec off\n  Port 1\n\nHost gh\n  User git\n",
+			nil,
+			"gh",
+			map[string]bool{"on-vpn gh": true},
+			[]string{"hostname gh", "port 22", "user work"},
+			0,
+		},
+		{
+			"unsupported Match is skipped",
+			"Match canonical\n  User x\n\nHost gh\n  User git\n",
+			nil,
+			"gh",
+			nil,
+			[]string{"hostname gh", "port 22", "user git"},
+			1,
+		},
+		{
+			"include at the top level",
+			"Include config.d/*\n\nHost *\n  User nobody\n",
+			map[string]string{"config.d/a": "Port 2222\n\nHost gh\n  User git\n"},
+			"gh",
+			nil,
+			[]string{"hostname gh", "port 2222", "user git"},
+			0,
+		},
+		{
+			"include under a matching Host",
+			"Host gh\n  Include extra.conf\n",
+			map[string]string{"extra.conf": "User git\n\nHost *\n  Port 443\n"},
+			"gh",
+			nil,
+			[]string{"hostname gh", "port 443", "user git"},
+			0,
+		},
+		{
+			"include under a Host that does not match",
+			"Host foo\n  Include extra.conf\n\nHost *\n  User git\n",
+			map[string]string{"extra.conf": "Port 443\n\nHost *\n  User bob\n\nMatch all\n  HostName example.com\n"},
+			"gh",
+			nil,
+			[]string{"hostname gh", "port 22", "user git"},
+			0,
+		},
+		{
+			"nested include under a Host that does not match",
+			"Host foo\n  Include a.conf\n\nHost *\n  User git\n",
+			map[string]string{"a.conf": "Host *\n  Include b.conf\n", "b.conf": "User bob\n\nHost gh\n  Port 443\n"},
+			"gh",
+			nil,
+			[]string{"hostname gh", "port 22", "user git"},
+			0,
+		},
+		{
+			"include under a Match that does not match",
+			"Match exec off\n  Include extra.conf\n\nHost gh\n  User git\n",
+			map[string]string{"extra.conf": "Host *\n  User bob\n"},
+			"gh",
+			nil,
+			[]string{"hostname gh", "port 22", "user git"},
+			0,
+		},
+		{
+			"include under an unsupported Match",
+			"Match canonical\n  Include extra.conf\n\nHost gh\n  User git\n",
+			map[string]string{"extra.conf": "Port 443\n\nHost *\n  User bob\n"},
+			"gh",
+			nil,
+			[]string{"hostname gh", "port 22", "user git"},
+			3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.files == nil {
+				tt.files = map[string]string{}
+			}
+			configFile := lintFixture(t, tt.config, tt.files)
+			homeDir := filepath.Dir(filepath.Dir(configFile))
+			res, err := resolveHostConfig(configFile, tt.alias, func(command string) bool {
+				return tt.exec[command]
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, o := range res.Options {
+				if pathKeywords[o.Keyword] {
+					if rel, err := filepath.Rel(homeDir, o.Value); err == nil {
+						o.Value = filepath.ToSlash(filepath.Join("~", rel))
+					}
+				}
+				got = append(got, o.Keyword+" "+o.Value)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("options:\ngot  %q\nwant %q", got, tt.want)
+			}
+			if len(res.Skipped) != tt.skipped {
+				t.Errorf("%d block(s) skipped, want %d", len(res.Skipped), tt.skipped)
+			}
+		})
+	}
+}
+
+func TestResolveHostConfigSources(t *testing.T) {
+	configFile := lintFixture(t, "Host gh\n  User git\n", map[string]string{})
+	res, err := resolveHostConfig(configFile, "gh", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, o := range res.Options {
+		switch o.Keyword {
+		case "user":
+			if o.File != configFile || o.Line != 2 {
+				t.Errorf("User comes from %s:%d, want config:2", o.File, o.Line)
+			}
+		default:
+			if o.File != "" {
+				t.Errorf("default %s has source %s:%d", o.Keyword, o.File, o.Line)
+			}
+		}
+	}
+	if len(res.Applied) != 2 {
+		t.Errorf("%d block(s) applied, want the global section and Host gh", len(res.Applied))
+	}
+}
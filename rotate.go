@@ -0,0 +1,197 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// rotationRequest describes a rotation. OldPublicKey is the current key's
+// authorized_keys line; when empty it is read from the key's .pub file.
+type rotationRequest struct {
+	SSHDir       string
+	ConfigFile   string
+	Label        string
+	Alias        string
+	Token        string
+	Title        string
+	OldPublicKey string
+	Options      keyOptions
+}
+
+type rotationResult struct {
+	KeyPath    string
+	ArchiveDir string
+	GitHubID   int64
+}
+
+// rotateKey replaces the key bound to req.Alias with a freshly generated one.
+// Every completed step registers an undo action; if a later step fails the
+// undo actions run in reverse order and the original error is returned.
+func rotateKey(req rotationRequest, progress func(string)) (*rotationResult, error) {
+	oldPath, ok := findKeyBasePath(req.SSHDir, req.Label)
+	if !ok {
+		return nil, fmt.Errorf("no existing key found for label %s", req.Label)
+	}
+	oldPub := req.OldPublicKey
+	if oldPub == "" {
+		data, err := os.ReadFile(oldPath + ".pub")
+		if err != nil {
+			return nil, fmt.Errorf("cannot read current public key: %w", err)
+		}
+		oldPub = string(data)
+	}
+	originalConfig, err := os.ReadFile(req.ConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := hostBlockOptions(originalConfig, req.Alias); !ok {
+		return nil, fmt.Errorf("host alias %s not found in SSH config", req.Alias)
+	}
+	if req.Options.Algorithm.Type == "" {
+		req.Options.Algorithm = keyAlgorithms[0]
+	}
+
+	var undo []func() error
+	rollback := func(cause error) (*rotationResult, error) {
+		progress("Rotation failed, rolling back: " + cause.Error())
+		var errs []error
+		for i := len(undo) - 1; i >= 0; i-- {
+			if err := undo[i](); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if len(errs) > 0 {
+			return nil, fmt.Errorf("%w (rollback incomplete: %v)", cause, errors.Join(errs...))
+		}
+		return nil, cause
+	}
+
+	v := newTemplateVars(req.Label, req.Alias, req.Options.Algorithm)
+	finalPath := keyBasePath(req.SSHDir, v)
+	stagingPath := finalPath + ".rotating"
+	if err := createKeyPair(stagingPath, naming.comment(v), req.Options); err != nil {
+		return nil, fmt.Errorf("generate new key: %w", err)
+	}
+	undo = append(undo, func() error { return removeKeyFiles(stagingPath) })
+	progress("New key generated: " + stagingPath)
+
+	newPub, err := os.ReadFile(stagingPath + ".pub")
+	if err != nil {
+		return rollback(err)
+	}
+	title := req.Title
+	if title == "" {
+		title = naming.title(v)
+	}
+	resp, err := uploadKeyToGitHub(req.Token, title, strings.TrimSpace(string(newPub)))
+	if err != nil {
+		if resp != nil && resp.Message != "" {
+			err = errors.New(resp.Message)
+		}
+		return rollback(fmt.Errorf("upload new key: %w", err))
+	}
+	undo = append(undo, func() error { return deleteGitHubKey(req.Token, resp.ID) })
+	progress(fmt.Sprintf("New key uploaded to GitHub (ID: %d)", resp.ID))
+
+	signer, err := loadSigner(stagingPath, req.Options.Passphrase)
+	if err != nil {
+		return rollback(err)
+	}
+	if _, err := testSSHKey(req.SSHDir, req.ConfigFile, req.Alias, signer); err != nil {
+		return rollback(err)
+	}
+	progress("SSH test with new key passed for " + req.Alias)
+
+	archiveDir, err := archiveKeyFiles(req.SSHDir, oldPath)
+	if err != nil {
+		return rollback(fmt.Errorf("archive old key: %w", err))
+	}
+	undo = append(undo, func() error { return restoreArchivedKeyFiles(archiveDir, oldPath) })
+	progress("Old key archived to " + archiveDir)
+
+	if err := moveKeyFiles(stagingPath, finalPath); err != nil {
+		return rollback(fmt.Errorf("install new key: %w", err))
+	}
+	undo = append(undo, func() error { return moveKeyFiles(finalPath, stagingPath) })
+
+	updated, err := setHostIdentityFile(originalConfig, req.Alias, finalPath)
+	if err != nil {
+		return rollback(err)
+	}
+	if err := writeSSHFile(req.SSHDir, req.ConfigFile, updated, 0o600); err != nil {
+		return rollback(fmt.Errorf("update SSH config: %w", err))
+	}
+	undo = append(undo, func() error { return writeSSHFile(req.SSHDir, req.ConfigFile, originalConfig, 0o600) })
+	progress("IdentityFile for " + req.Alias + " now points to " + finalPath)
+
+	oldKey, err := findGitHubKey(req.Token, oldPub)
+	if err != nil {
+		return rollback(fmt.Errorf("look up old key on GitHub: %w", err))
+	}
+	if oldKey == nil {
+		progress("Old key was not found on GitHub; nothing to delete")
+	} else {
+		if err := deleteGitHubKey(req.Token, oldKey.ID); err != nil {
+			return rollback(fmt.Errorf("delete old key from GitHub: %w", err))
+		}
+		progress(fmt.Sprintf("Old key deleted from GitHub (ID: %d)", oldKey.ID))
+	}
+
+	return &rotationResult{KeyPath: finalPath, ArchiveDir: archiveDir, GitHubID: resp.ID}, nil
+}
+
+// archiveKeyFiles moves keyPath and keyPath.pub into a new timestamped
+// directory under sshDir/archive and returns that directory.
+func archiveKeyFiles(sshDir, keyPath string) (string, error) {
+	dir := filepath.Join(sshDir, "archive", time.Now().Format("20060102-150405")+"-"+filepath.Base(keyPath))
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	if err := moveKeyFiles(keyPath, filepath.Join(dir, filepath.Base(keyPath))); err != nil {
+		_ = os.Remove(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+func restoreArchivedKeyFiles(archiveDir, keyPath string) error {
+	if err := moveKeyFiles(filepath.Join(archiveDir, filepath.Base(keyPath)), keyPath); err != nil {
+		return err
+	}
+	return os.Remove(archiveDir)
+}
+
+// moveKeyFiles renames a key pair. A missing half is skipped, but at least
+// one of the two files must exist.
+func moveKeyFiles(from, to string) error {
+	moved := 0
+	for _, suffix := range []string{"", ".pub"} {
+		if _, err := os.Stat(from + suffix); os.IsNotExist(err) {
+			continue
+		}
+		if _, err := os.Stat(to + suffix); err == nil {
+			return fmt.Errorf("refusing to overwrite %s", to+suffix)
+		}
+		if err := os.Rename(from+suffix, to+suffix); err != nil {
+			return err
+		}
+		moved++
+	}
+	if moved == 0 {
+		return fmt.Errorf("no key files found at %s", from)
+	}
+	return nil
+}
+
+func removeKeyFiles(keyPath string) error {
+	for _, path := range []string{keyPath, keyPath + ".pub"} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -3,12 +3,18 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
 )
 
 func getSSHDirectory() (string, error) {
@@ -29,52 +35,133 @@ func ensureSSHDirectory(sshDir string) error {
 	return nil
 }
 
-func keyBasePath(sshDir, label string) string {
-	return filepath.Join(sshDir, "id_ed25519_"+label)
+// keyBasePath is where a new key described by v is stored, as given by the
+// file name template.
+func keyBasePath(sshDir string, v templateVars) string {
+	return filepath.Join(sshDir, naming.fileName(v))
 }
 
-func generateKeyPair(sshDir, label string) (string, error) {
-	keyPath := keyBasePath(sshDir, label)
-	if _, err := os.Stat(keyPath); err == nil {
-		return "", fmt.Errorf("key already exists: %s", keyPath)
+// findKeyBasePath locates the key for label regardless of its algorithm.
+// A key counts as present if either the private or the public half exists.
+// Names from the current file name template are tried first, then the
+// default <prefix>_<label> names used by earlier versions.
+func findKeyBasePath(sshDir, label string) (string, bool) {
+	if paths := keyFileCandidates(sshDir, label); len(paths) > 0 {
+		return paths[0], true
+	}
+	for _, prefix := range keyFilePrefixes {
+		path := filepath.Join(sshDir, prefix+"_"+label)
+		if _, err := os.Stat(path); err == nil {
+			return path, true
+		}
+		if _, err := os.Stat(path + ".pub"); err == nil {
+			return path, true
+		}
 	}
+	return "", false
+}
 
-	cmd := exec.Command("ssh-keygen", "-t", "ed25519", "-C", label+"@github", "-f", keyPath, "-N", "")
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("ssh-keygen failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+func generateKeyPair(sshDir, label, alias string, opts keyOptions) (string, error) {
+	if existing, ok := findKeyBasePath(sshDir, label); ok {
+		return "", fmt.Errorf("key already exists: %s", existing)
+	}
+	if opts.Algorithm.Type == "" {
+		opts.Algorithm = keyAlgorithms[0]
+	}
+	v := newTemplateVars(label, alias, opts.Algorithm)
+	keyPath := keyBasePath(sshDir, v)
+	if err := createKeyPair(keyPath, naming.comment(v), opts); err != nil {
+		return "", err
+	}
+	return keyPath, nil
+}
+
+// createKeyPair writes a new key pair to keyPath and keyPath.pub using the
+// backend selected in opts.
+func createKeyPair(keyPath, comment string, opts keyOptions) error {
+	if opts.Algorithm.Type == "" {
+		opts.Algorithm = keyAlgorithms[0]
+	}
+	if opts.Passphrase != "" {
+		if err := validateKDFRounds(opts.KDFRounds); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	switch opts.Backend {
+	case keygenSSHKeygen:
+		err = generateKeyPairSSHKeygen(keyPath, comment, opts)
+	default:
+		err = generateKeyPairBuiltin(keyPath, comment, opts)
+	}
+	if err != nil {
+		return err
 	}
 
 	if runtime.GOOS != "windows" {
 		_ = os.Chmod(keyPath, 0o600)
 		_ = os.Chmod(keyPath+".pub", 0o644)
 	}
-
-	return keyPath, nil
+	return nil
 }
 
-func ensureGitHubKnownHost(sshDir string) error {
+// GitHub also serves SSH on port 443 of ssh.github.com, for networks that
+// block port 22.
+const (
+	gitHubSSH443Host = "ssh.github.com"
+	gitHubSSH443Port = "443"
+)
+
+// gitHubKnownHostChanges returns the known_hosts edit that adds GitHub's
+// host keys, or nothing if they are already present. With port443 the keys
+// are fetched from and recorded for [ssh.github.com]:443 instead of
+// github.com.
+func gitHubKnownHostChanges(sshDir string, port443 bool) ([]fileChange, error) {
 	knownHostsPath := filepath.Join(sshDir, "known_hosts")
-	if contains, err := fileContainsHost(knownHostsPath, "github.com"); err == nil && contains {
-		return nil
+	name, args := "github.com", []string{"github.com"}
+	if port443 {
+		name = "[" + gitHubSSH443Host + "]:" + gitHubSSH443Port
+		args = []string{"-p", gitHubSSH443Port, gitHubSSH443Host}
+	}
+	if contains, err := fileContainsHost(knownHostsPath, name); err == nil && contains {
+		return nil, nil
 	}
 
-	cmd := exec.Command("ssh-keyscan", "github.com")
+	cmd := exec.Command("ssh-keyscan", args...)
 	out, err := cmd.Output()
 	if err != nil {
-		return fmt.Errorf("ssh-keyscan failed: %w", err)
+		return nil, fmt.Errorf("ssh-keyscan failed: %w", err)
+	}
+	if strings.TrimSpace(string(out)) == "" {
+		return nil, fmt.Errorf("ssh-keyscan returned no host keys for %s", name)
 	}
 
-	f, err := os.OpenFile(knownHostsPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	before, err := readFileIfExists(knownHostsPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer f.Close()
-	if _, err := f.Write(out); err != nil {
+	after := appendLines(before, strings.Split(strings.TrimSpace(string(out)), "\n"))
+	return []fileChange{{Path: knownHostsPath, Before: before, After: after, Perm: 0o644}}, nil
+}
+
+// appendKnownHosts adds lines to sshDir/known_hosts, backing it up and
+// rewriting it atomically.
+func appendKnownHosts(sshDir string, lines []string) error {
+	path := filepath.Join(sshDir, "known_hosts")
+	data, err := readFileIfExists(path)
+	if err != nil {
 		return err
 	}
-	return nil
+	return writeSSHFile(sshDir, path, appendLines(data, lines), 0o644)
+}
+
+func appendLines(data []byte, lines []string) []byte {
+	out := append([]byte(nil), data...)
+	if len(out) > 0 && !bytes.HasSuffix(out, []byte("\n")) {
+		out = append(out, '\n')
+	}
+	return append(out, strings.Join(lines, "\n")+"\n"...)
 }
 
 func fileContainsHost(path, host string) (bool, error) {
@@ -97,29 +184,74 @@ func fileContainsHost(path, host string) (bool, error) {
 	return false, s.Err()
 }
 
-func ensureSSHConfigEntry(configFile, hostAlias, keyPath string) error {
-	if err := ensureConfigFile(configFile); err != nil {
-		return err
+// managedConfigFile is the file that holds the app's Host entries in
+// include mode.
+func managedConfigFile(sshDir string) string {
+	return filepath.Join(sshDir, "config.d", "github-ssh-manager.conf")
+}
+
+// sshConfigEntryChanges returns the edits that add a block for hostAlias to
+// targetFile. When targetFile is not configFile, configFile is also made to
+// Include it. Nothing is written.
+//
+// With an empty condition the block is a Host block, added unless configFile
+// or a file it includes already defines the alias. Otherwise it is a Match
+// block for the alias under the extra criteria in condition, added unless
+// the same Match line exists. It goes in the file holding the alias's Host
+// block, if there is one, before the alias's other entries so that its
+// options take precedence while it matches.
+//
+// With port443 the block connects to ssh.github.com on port 443.
+func sshConfigEntryChanges(configFile, targetFile, hostAlias, keyPath, condition string, port443 bool) ([]fileChange, error) {
+	header := "Host " + hostAlias
+	exists := func() bool { return hasHostAlias(configFile, hostAlias) || hasHostAlias(targetFile, hostAlias) }
+	if condition != "" {
+		var err error
+		if header, err = matchHeader(hostAlias, condition); err != nil {
+			return nil, err
+		}
+		exists = func() bool { return hasHeader(configFile, header) || hasHeader(targetFile, header) }
+		if file, ok := findHostFile(configFile, hostAlias); ok {
+			targetFile = file
+		}
 	}
 
-	data, err := os.ReadFile(configFile)
-	if err != nil {
-		return err
+	var changes []fileChange
+	if targetFile != configFile {
+		before, err := readFileIfExists(configFile)
+		if err != nil {
+			return nil, err
+		}
+		if after := addInclude(before, configFile, targetFile); !bytes.Equal(before, after) {
+			changes = append(changes, fileChange{Path: configFile, Before: before, After: after, Perm: 0o600})
+		}
 	}
-	if hasHostAlias(data, hostAlias) {
-		return nil
+	if exists() {
+		return changes, nil
 	}
 
-	identityPath := filepath.ToSlash(keyPath)
-	entry := fmt.Sprintf("\nHost %s\n  HostName github.com\n  User git\n  IdentityFile %q\n  AddKeysToAgent yes\n  IdentitiesOnly yes\n", hostAlias, identityPath)
-
-	f, err := os.OpenFile(configFile, os.O_APPEND|os.O_WRONLY, 0o600)
+	before, err := readFileIfExists(targetFile)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer f.Close()
-	_, err = f.WriteString(entry)
-	return err
+	cfg := parseSSHConfig(before)
+	options := [][2]string{{"HostName", "github.com"}}
+	if port443 {
+		options = [][2]string{{"HostName", gitHubSSH443Host}, {"Port", gitHubSSH443Port}}
+	}
+	options = append(options,
+		[2]string{"User", "git"},
+		[2]string{"IdentityFile", quoteConfigArg(filepath.ToSlash(keyPath))},
+		[2]string{"AddKeysToAgent", "yes"},
+		[2]string{"IdentitiesOnly", "yes"},
+	)
+	if idxs := cfg.aliasBlocks(hostAlias); condition != "" && len(idxs) > 0 {
+		cfg.insertBlock(idxs[0], cfg.newBlock(header, options))
+	} else {
+		cfg.appendBlock(header, options)
+	}
+	// The new block goes in before the Include that points at it.
+	return append([]fileChange{{Path: targetFile, Before: before, After: cfg.Bytes(), Perm: 0o600}}, changes...), nil
 }
 
 func ensureConfigFile(configFile string) error {
@@ -136,29 +268,133 @@ func ensureConfigFile(configFile string) error {
 	return nil
 }
 
-func hasHostAlias(config []byte, hostAlias string) bool {
-	s := bufio.NewScanner(bytes.NewReader(config))
-	needle := strings.ToLower(hostAlias)
-	for s.Scan() {
-		line := strings.TrimSpace(s.Text())
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
+// removeHostFromConfig backs up configFile into sshDir/backups and removes
+// hostAlias from it. It returns the backup path and the removed text.
+func removeHostFromConfig(sshDir, configFile, hostAlias string) (string, string, error) {
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		return "", "", err
+	}
+	updated, removed, err := removeHostAlias(data, hostAlias)
+	if err != nil {
+		return "", "", err
+	}
+	backup, err := backupFile(sshDir, configFile)
+	if err != nil {
+		return "", "", fmt.Errorf("back up SSH config: %w", err)
+	}
+	if err := writeFileAtomic(configFile, updated, 0o600); err != nil {
+		return "", "", err
+	}
+	return backup, removed, nil
+}
+
+// hasHostAlias reports whether configFile, or any file it includes, has a
+// Host block listing hostAlias. A Match rule naming it does not count.
+func hasHostAlias(configFile, hostAlias string) bool {
+	_, ok := findHostFile(configFile, hostAlias)
+	return ok
+}
+
+// hostBlockOptions returns the options of the first Host block that lists
+// hostAlias, keyed by lower-cased keyword.
+func hostBlockOptions(config []byte, hostAlias string) (map[string]string, bool) {
+	b := parseSSHConfig(config).findHost(hostAlias)
+	if b == nil {
+		return nil, false
+	}
+	return b.options(), true
+}
+
+// setHostPort443 points every Host and Match block naming hostAlias at
+// ssh.github.com on port 443.
+func setHostPort443(config []byte, hostAlias string) ([]byte, error) {
+	return setHostOptions(config, hostAlias, [][2]string{
+		{"HostName", gitHubSSH443Host},
+		{"Port", gitHubSSH443Port},
+	})
+}
+
+// setHostIdentityFile rewrites the IdentityFile of every Host and Match
+// block naming hostAlias, adding one where a block has none.
+func setHostIdentityFile(config []byte, hostAlias, keyPath string) ([]byte, error) {
+	return setHostOptions(config, hostAlias, [][2]string{
+		{"IdentityFile", quoteConfigArg(filepath.ToSlash(keyPath))},
+	})
+}
+
+// setHostOptions sets options in every block naming hostAlias, so a Match
+// rule for the alias does not keep connecting with stale settings.
+func setHostOptions(config []byte, hostAlias string, options [][2]string) ([]byte, error) {
+	cfg := parseSSHConfig(config)
+	idxs := cfg.aliasBlocks(hostAlias)
+	if len(idxs) == 0 {
+		return nil, fmt.Errorf("host alias %s not found in SSH config", hostAlias)
+	}
+	for _, i := range idxs {
+		for _, opt := range options {
+			cfg.Blocks[i].setOption(opt[0], opt[1], cfg.newline)
 		}
-		parts := strings.Fields(line)
-		if len(parts) >= 2 && strings.EqualFold(parts[0], "host") {
-			for _, alias := range parts[1:] {
-				if strings.ToLower(alias) == needle {
-					return true
-				}
-			}
+	}
+	return cfg.Bytes(), nil
+}
+
+// removeHostAlias drops hostAlias from config, including Match rules naming
+// it, as described by sshConfig.removeHost and returns the removed text for
+// display.
+func removeHostAlias(config []byte, hostAlias string) ([]byte, string, error) {
+	cfg := parseSSHConfig(config)
+	removed, ok := cfg.removeHost(hostAlias)
+	if !ok {
+		return nil, "", fmt.Errorf("host alias %s not found in SSH config", hostAlias)
+	}
+	return cfg.Bytes(), removed, nil
+}
+
+// hostBlockText returns the Host line and options of the block listing
+// hostAlias, without the comments and blank lines that trail it.
+func hostBlockText(config []byte, hostAlias string) (string, bool) {
+	b := parseSSHConfig(config).findHost(hostAlias)
+	if b == nil {
+		return "", false
+	}
+	return b.text(), true
+}
+
+func lineEnding(line string) string {
+	switch {
+	case strings.HasSuffix(line, "\r\n"):
+		return "\r\n"
+	case strings.HasSuffix(line, "\n"):
+		return "\n"
+	}
+	return ""
+}
+
+func containsFold(values []string, needle string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, needle) {
+			return true
 		}
 	}
 	return false
 }
 
+// errPublicKeyMissing is returned by readPublicKey when the private key
+// exists but its .pub file does not.
+var errPublicKeyMissing = errors.New("public key file is missing")
+
 func readPublicKey(sshDir, label string) (string, error) {
-	path := keyBasePath(sshDir, label) + ".pub"
-	data, err := os.ReadFile(path)
+	keyPath, ok := findKeyBasePath(sshDir, label)
+	if !ok {
+		return "", fmt.Errorf("cannot read public key: no key found for label %q in %s", label, sshDir)
+	}
+	data, err := os.ReadFile(keyPath + ".pub")
+	if os.IsNotExist(err) {
+		if _, statErr := os.Stat(keyPath); statErr == nil {
+			return "", fmt.Errorf("cannot read public key: %s.pub: %w", keyPath, errPublicKeyMissing)
+		}
+	}
 	if err != nil {
 		return "", fmt.Errorf("cannot read public key: %w", err)
 	}
@@ -166,7 +402,7 @@ func readPublicKey(sshDir, label string) (string, error) {
 }
 
 func testSSHConnection(hostAlias string) (string, error) {
-	cmd := exec.Command("ssh", "-T", "git@"+hostAlias)
+	cmd := exec.Command("ssh", "-T", "-o", "ConnectTimeout=15", "git@"+hostAlias)
 	var out, stderr bytes.Buffer
 	cmd.Stdout = &out
 	cmd.Stderr = &stderr
@@ -180,3 +416,59 @@ func testSSHConnection(hostAlias string) (string, error) {
 	}
 	return combined, fmt.Errorf("SSH test failed")
 }
+
+// isPort22Timeout reports whether ssh output shows the connection to port
+// 22 timing out, which usually means the network blocks it.
+func isPort22Timeout(output string) bool {
+	output = strings.ToLower(output)
+	return strings.Contains(output, "port 22:") && strings.Contains(output, "timed out")
+}
+
+// testSSHKey authenticates to the host behind hostAlias with signer instead
+// of whatever IdentityFile the config currently names, verifying the server
+// against known_hosts in sshDir.
+func testSSHKey(sshDir, configFile, hostAlias string, signer ssh.Signer) (string, error) {
+	config, err := os.ReadFile(configFile)
+	if err != nil {
+		return "", err
+	}
+	opts, _ := hostBlockOptions(config, hostAlias)
+	host, port, user := hostAlias, "22", "git"
+	if v := opts["hostname"]; v != "" {
+		host = v
+	}
+	if v := opts["port"]; v != "" {
+		port = v
+	}
+	if v := opts["user"]; v != "" {
+		user = v
+	}
+
+	hostKeyCallback, err := knownhosts.New(filepath.Join(sshDir, "known_hosts"))
+	if err != nil {
+		return "", fmt.Errorf("cannot load known_hosts: %w", err)
+	}
+	client, err := ssh.Dial("tcp", net.JoinHostPort(host, port), &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         15 * time.Second,
+	})
+	if err != nil {
+		return "", fmt.Errorf("SSH test failed: %w", err)
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("SSH test failed: %w", err)
+	}
+	defer session.Close()
+	var out bytes.Buffer
+	session.Stdout = &out
+	session.Stderr = &out
+	if err := session.Shell(); err == nil {
+		_ = session.Wait()
+	}
+	return strings.TrimSpace(out.String()), nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// identityFilePaths are key paths that must survive being written into a
+// Host block and read back by the parser.
+var identityFilePaths = []string{
+	"/home/me/.ssh/id_ed25519_work",
+	"/home/me/.ssh/my keys/id_ed25519_work",
+	"/home/jürgen/.ssh/ключ_работа",
+	"/home/me/.ssh/tab\there",
+	`/home/me/.ssh/quote"and'apostrophe`,
+	"C:/Users/me/.ssh/id_rsa_#1",
+}
+
+func TestSSHConfigEntryIdentityFileRoundTrip(t *testing.T) {
+	for _, keyPath := range identityFilePaths {
+		configFile := filepath.Join(t.TempDir(), "config")
+		changes, err := sshConfigEntryChanges(configFile, configFile, "gh", keyPath, "", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(changes) != 1 {
+			t.Fatalf("%q: %d changes, want 1", keyPath, len(changes))
+		}
+		b := parseSSHConfig(changes[0].After).findHost("gh")
+		if b == nil {
+			t.Fatalf("%q: no Host gh in\n%s", keyPath, changes[0].After)
+		}
+		if got := b.options()["identityfile"]; got != keyPath {
+			t.Errorf("IdentityFile reads back as %q, want %q", got, keyPath)
+		}
+	}
+}
+
+func TestSetHostIdentityFileRoundTrip(t *testing.T) {
+	config := []byte("Host gh\n  HostName github.com\n  IdentityFile ~/.ssh/old\n\nMatch originalhost gh exec \"on-vpn\"\n  IdentityFile ~/.ssh/old\n")
+	for _, keyPath := range identityFilePaths {
+		out, err := setHostIdentityFile(config, "gh", keyPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg := parseSSHConfig(out)
+		for _, idx := range cfg.aliasBlocks("gh") {
+			b := cfg.Blocks[idx]
+			if got := b.options()["identityfile"]; got != keyPath {
+				t.Errorf("%s: IdentityFile reads back as %q, want %q", b.Header.value(), got, keyPath)
+			}
+		}
+	}
+}
+
+func TestEnsureSSHConfigEntryNonASCIIPath(t *testing.T) {
+	sshDir := filepath.Join(t.TempDir(), ".ssh")
+	if err := os.MkdirAll(sshDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	configFile := filepath.Join(sshDir, "config")
+	keyPath := filepath.Join(sshDir, "ключ_работа")
+	changes, err := sshConfigEntryChanges(configFile, configFile, "gh", keyPath, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := applyFileChanges(sshDir, changes); err != nil {
+		t.Fatal(err)
+	}
+	res, err := resolveHostConfig(configFile, "gh", func(string) bool { return false })
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, o := range res.Options {
+		if o.Keyword == "identityfile" {
+			if o.Value != filepath.ToSlash(keyPath) {
+				t.Errorf("resolved IdentityFile %q, want %q", o.Value, filepath.ToSlash(keyPath))
+			}
+			return
+		}
+	}
+	t.Error("IdentityFile not resolved")
+}
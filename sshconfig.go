@@ -0,0 +1,653 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sshConfig is a parsed ssh_config file. Every line keeps its original text,
+// so a config that is parsed and written back unchanged is identical byte
+// for byte; only lines touched through the methods below are re-rendered.
+type sshConfig struct {
+	// Global holds the lines before the first Host or Match line.
+	Global  *configBlock
+	Blocks  []*configBlock
+	newline string
+}
+
+// configBlock is a Host or Match line and the lines up to the next one.
+// Comments and blank lines stay in the block they appear in.
+type configBlock struct {
+	Header *configLine
+	Lines  []*configLine
+}
+
+// configLine is one line of the file. Keyword is empty for blank lines and
+// comments; Args are the unquoted arguments. Line is the 1-based line number
+// at parse time.
+type configLine struct {
+	raw     string
+	Keyword string
+	Args    []string
+	Line    int
+}
+
+func parseSSHConfig(data []byte) *sshConfig {
+	text := string(data)
+	c := &sshConfig{Global: &configBlock{}, newline: "\n"}
+	if strings.Contains(text, "\r\n") {
+		c.newline = "\r\n"
+	}
+
+	current := c.Global
+	for i, raw := range strings.SplitAfter(text, "\n") {
+		if raw == "" {
+			continue
+		}
+		line := parseConfigLine(raw)
+		line.Line = i + 1
+		if line.is("host") || line.is("match") {
+			current = &configBlock{Header: line}
+			c.Blocks = append(c.Blocks, current)
+			continue
+		}
+		current.Lines = append(current.Lines, line)
+	}
+	return c
+}
+
+// parseConfigLine splits a line the way ssh does: the keyword ends at
+// whitespace or '=', an optional '=' may separate it from the arguments, and
+// arguments may be quoted.
+func parseConfigLine(raw string) *configLine {
+	l := &configLine{raw: raw}
+	text := strings.TrimSpace(raw)
+	if text == "" || text[0] == '#' {
+		return l
+	}
+	end := strings.IndexAny(text, " \t=")
+	if end < 0 {
+		l.Keyword = text
+		return l
+	}
+	l.Keyword = text[:end]
+	rest := strings.TrimLeft(text[end:], " \t")
+	if strings.HasPrefix(rest, "=") {
+		rest = strings.TrimLeft(rest[1:], " \t")
+	}
+	l.Args = splitConfigArgs(rest)
+	return l
+}
+
+// splitConfigArgs splits s into arguments. Single or double quotes group
+// words, a backslash escapes a quote, backslash or space, and an unquoted
+// word starting with '#' ends the line.
+func splitConfigArgs(s string) []string {
+	var args []string
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" || s[0] == '#' {
+			return args
+		}
+		var b strings.Builder
+		var quote byte
+		i := 0
+		for ; i < len(s); i++ {
+			ch := s[i]
+			if ch == '\\' && i+1 < len(s) && strings.IndexByte(`\"' `, s[i+1]) >= 0 && (quote == 0 || s[i+1] != ' ') {
+				i++
+				b.WriteByte(s[i])
+				continue
+			}
+			if quote != 0 {
+				if ch == quote {
+					quote = 0
+				} else {
+					b.WriteByte(ch)
+				}
+				continue
+			}
+			if ch == '"' || ch == '\'' {
+				quote = ch
+				continue
+			}
+			if ch == ' ' || ch == '\t' {
+				break
+			}
+			b.WriteByte(ch)
+		}
+		args = append(args, b.String())
+		s = s[i:]
+	}
+}
+
+// quoteConfigArg quotes s if ssh would otherwise split or misread it. Inside
+// double quotes ssh only undoes backslash escapes of quotes and
+// backslashes, so those are the only characters escaped.
+func quoteConfigArg(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\"'\\#") {
+		return s
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func (l *configLine) is(keyword string) bool {
+	return strings.EqualFold(l.Keyword, keyword)
+}
+
+func (l *configLine) value() string {
+	return strings.Join(l.Args, " ")
+}
+
+func (l *configLine) indent() string {
+	return l.raw[:len(l.raw)-len(strings.TrimLeft(l.raw, " \t"))]
+}
+
+// Bytes renders the config.
+func (c *sshConfig) Bytes() []byte {
+	var b strings.Builder
+	for _, l := range c.lines() {
+		b.WriteString(l.raw)
+	}
+	return []byte(b.String())
+}
+
+// lines returns every line in file order.
+func (c *sshConfig) lines() []*configLine {
+	out := append([]*configLine{}, c.Global.Lines...)
+	for _, b := range c.Blocks {
+		out = append(out, b.Header)
+		out = append(out, b.Lines...)
+	}
+	return out
+}
+
+// findHost returns the first Host block listing alias, compared without
+// regard to case, or nil. Match blocks naming alias are not considered.
+func (c *sshConfig) findHost(alias string) *configBlock {
+	for _, b := range c.Blocks {
+		if b.Header.is("host") && containsFold(b.Header.Args, alias) {
+			return b
+		}
+	}
+	return nil
+}
+
+// aliasBlocks returns the indexes of every block that names alias: Host
+// blocks listing it and Match blocks with it in a host or originalhost
+// criterion.
+func (c *sshConfig) aliasBlocks(alias string) []int {
+	var idxs []int
+	for i, b := range c.Blocks {
+		if definesAlias(b.Header, alias) {
+			idxs = append(idxs, i)
+		}
+	}
+	return idxs
+}
+
+// appendBlock adds a block at the end of the file, separated from the
+// previous content by a blank line. Each option is a keyword and an already
+// rendered value.
+func (c *sshConfig) appendBlock(header string, options [][2]string) *configBlock {
+	b := c.newBlock(header, options)
+	c.addBlock(b)
+	return b
+}
+
+// newBlock renders a block with the config's line endings without adding
+// it to the config.
+func (c *sshConfig) newBlock(header string, options [][2]string) *configBlock {
+	b := &configBlock{Header: parseConfigLine(header + c.newline)}
+	for _, opt := range options {
+		b.Lines = append(b.Lines, parseConfigLine("  "+opt[0]+" "+opt[1]+c.newline))
+	}
+	return b
+}
+
+// addBlock puts b at the end of the file after a blank line.
+func (c *sshConfig) addBlock(b *configBlock) {
+	all := c.lines()
+	if len(all) > 0 && lineEnding(all[len(all)-1].raw) == "" {
+		all[len(all)-1].raw += c.newline
+	}
+	prev := c.Global
+	if len(c.Blocks) > 0 {
+		prev = c.Blocks[len(c.Blocks)-1]
+	}
+	prev.Lines = append(prev.Lines, parseConfigLine(c.newline))
+	c.Blocks = append(c.Blocks, b)
+}
+
+// insertBlock puts b before the block at idx, separated from it by a blank
+// line. Comments directly above that block stay with it.
+func (c *sshConfig) insertBlock(idx int, b *configBlock) {
+	prev := c.Global
+	if idx > 0 {
+		prev = c.Blocks[idx-1]
+	}
+	lead := prev.takeTrailingComments()
+	b.Lines = append(b.Lines, parseConfigLine(c.newline))
+	b.Lines = append(b.Lines, lead...)
+	c.Blocks = append(c.Blocks[:idx], append([]*configBlock{b}, c.Blocks[idx:]...)...)
+}
+
+// removeHost drops alias from every block that names it. From a Host line
+// naming other patterns too, only the alias is removed; otherwise the whole
+// block goes, together with the blank line appendBlock puts before it.
+// Comments and blank lines after the last option are kept since they
+// usually introduce the next block. The removed text is returned.
+func (c *sshConfig) removeHost(alias string) (string, bool) {
+	idxs := c.aliasBlocks(alias)
+	if len(idxs) == 0 {
+		return "", false
+	}
+	// Later blocks go first so the earlier indexes stay valid.
+	removed := make([]string, len(idxs))
+	for i := len(idxs) - 1; i >= 0; i-- {
+		removed[i] = c.removeHostAt(idxs[i], alias)
+	}
+	return strings.Join(removed, ""), true
+}
+
+// removeHostAt drops alias from the block at idx, as removeHost does, and
+// returns the removed text.
+func (c *sshConfig) removeHostAt(idx int, alias string) string {
+	b := c.Blocks[idx]
+	if b.Header.is("host") && len(b.Header.Args) > 1 {
+		removed := b.Header.raw
+		var kept []string
+		for _, p := range b.Header.Args {
+			if !strings.EqualFold(p, alias) {
+				kept = append(kept, quoteConfigArg(p))
+			}
+		}
+		b.Header = parseConfigLine(b.Header.indent() + b.Header.Keyword + " " + strings.Join(kept, " ") + lineEnding(b.Header.raw))
+		return removed
+	}
+
+	var removed strings.Builder
+	blank, b := c.detachBlock(idx)
+	if blank != nil {
+		removed.WriteString(blank.raw)
+	}
+	removed.WriteString(b.text())
+	return removed.String()
+}
+
+// detachBlock takes the block at idx out of the config, together with the
+// blank line before it, which is returned if there was one. Comments and
+// blank lines after its last option stay behind, attached to the previous
+// block, and are no longer part of the returned block.
+func (c *sshConfig) detachBlock(idx int) (*configLine, *configBlock) {
+	b := c.Blocks[idx]
+	prev := c.Global
+	if idx > 0 {
+		prev = c.Blocks[idx-1]
+	}
+	var blank *configLine
+	if n := len(prev.Lines); n > 0 && prev.Lines[n-1].Keyword == "" && strings.TrimSpace(prev.Lines[n-1].raw) == "" {
+		blank = prev.Lines[n-1]
+		prev.Lines = prev.Lines[:n-1]
+	}
+	last := b.lastOption()
+	prev.Lines = append(prev.Lines, b.Lines[last+1:]...)
+	b.Lines = b.Lines[:last+1]
+	c.Blocks = append(c.Blocks[:idx], c.Blocks[idx+1:]...)
+	return blank, b
+}
+
+// takeTrailingComments removes the comment lines at the end of b that have
+// no blank line after them, and returns them. They describe the next block.
+func (b *configBlock) takeTrailingComments() []*configLine {
+	n := len(b.Lines)
+	for n > 0 && b.Lines[n-1].Keyword == "" && strings.TrimSpace(b.Lines[n-1].raw) != "" {
+		n--
+	}
+	lead := append([]*configLine{}, b.Lines[n:]...)
+	b.Lines = b.Lines[:n]
+	return lead
+}
+
+// lastOption returns the index in b.Lines of the last option line, or -1 if
+// the block only holds comments and blank lines.
+func (b *configBlock) lastOption() int {
+	last := -1
+	for i, l := range b.Lines {
+		if l.Keyword != "" {
+			last = i
+		}
+	}
+	return last
+}
+
+// text returns the header and option lines of b, without the comments and
+// blank lines that trail it.
+func (b *configBlock) text() string {
+	var s strings.Builder
+	s.WriteString(b.Header.raw)
+	for _, l := range b.Lines[:b.lastOption()+1] {
+		s.WriteString(l.raw)
+	}
+	return s.String()
+}
+
+// option returns the first line setting keyword, or nil.
+func (b *configBlock) option(keyword string) *configLine {
+	for _, l := range b.Lines {
+		if l.is(keyword) {
+			return l
+		}
+	}
+	return nil
+}
+
+// options returns the block's settings keyed by lower-cased keyword. Only
+// the first value of each keyword is kept, matching ssh's
+// first-obtained-value rule.
+func (b *configBlock) options() map[string]string {
+	opts := map[string]string{}
+	for _, l := range b.Lines {
+		if l.Keyword == "" || len(l.Args) == 0 {
+			continue
+		}
+		keyword := strings.ToLower(l.Keyword)
+		if _, seen := opts[keyword]; !seen {
+			opts[keyword] = l.value()
+		}
+	}
+	return opts
+}
+
+// setOption replaces the first line setting keyword with value, keeping its
+// indentation and line ending, or adds the option after the last one in the
+// block. value is written as given, so callers quote it as needed.
+func (b *configBlock) setOption(keyword, value, newline string) {
+	if l := b.option(keyword); l != nil {
+		*l = *parseConfigLine(l.indent() + l.Keyword + " " + value + lineEnding(l.raw))
+		return
+	}
+	b.appendOption(keyword+" "+value, newline)
+}
+
+// appendOption inserts text as a new option line after the last option in
+// the block, indented like its neighbours.
+func (b *configBlock) appendOption(text, newline string) {
+	indent := "  "
+	anchor := b.Header
+	last := b.lastOption()
+	if last >= 0 {
+		anchor = b.Lines[last]
+		indent = anchor.indent()
+	}
+	if lineEnding(anchor.raw) == "" {
+		anchor.raw += newline
+	}
+	line := parseConfigLine(indent + text + newline)
+	b.Lines = append(b.Lines[:last+1], append([]*configLine{line}, b.Lines[last+1:]...)...)
+}
+
+// removeOption deletes every line setting keyword.
+func (b *configBlock) removeOption(keyword string) {
+	kept := b.Lines[:0]
+	for _, l := range b.Lines {
+		if !l.is(keyword) {
+			kept = append(kept, l)
+		}
+	}
+	b.Lines = kept
+}
+
+// maxIncludeDepth matches the nesting limit ssh applies to Include.
+const maxIncludeDepth = 16
+
+// treeBlock is a block of a config file as ssh reads it. Parent is the Host
+// or Match line the file was included under, or nil at the top level.
+type treeBlock struct {
+	File   string
+	Block  *configBlock
+	Parent *configLine
+}
+
+// configTree returns the blocks of configFile and every file it includes,
+// directly or through other included files, in the order ssh reads them.
+// Each file's global lines come first as a block without a header. Files
+// named by an Include follow the block holding the Include line. Relative
+// Include paths are resolved against the directory of configFile, as ssh
+// does for ~/.ssh/config. Missing files are skipped like ssh does.
+func configTree(configFile string) ([]treeBlock, error) {
+	baseDir := filepath.Dir(configFile)
+	homeDir := filepath.Dir(baseDir)
+	seen := map[string]bool{}
+	var tree []treeBlock
+
+	var walk func(path string, parent *configLine, depth int) error
+	walk = func(path string, parent *configLine, depth int) error {
+		if depth > maxIncludeDepth {
+			return fmt.Errorf("too many nested Include directives at %s", path)
+		}
+		path = filepath.Clean(path)
+		if seen[path] {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		seen[path] = true
+		cfg := parseSSHConfig(data)
+		for _, b := range append([]*configBlock{cfg.Global}, cfg.Blocks...) {
+			tree = append(tree, treeBlock{File: path, Block: b, Parent: parent})
+			under := parent
+			if b.Header != nil {
+				under = b.Header
+			}
+			for _, l := range b.Lines {
+				if !l.is("include") {
+					continue
+				}
+				for _, inc := range includeMatches(l.Args, baseDir, homeDir) {
+					if err := walk(inc, under, depth+1); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk(configFile, nil, 0); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// configFiles returns configFile followed by every file it includes, in the
+// order ssh reads them.
+func configFiles(configFile string) ([]string, error) {
+	tree, err := configTree(configFile)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, tb := range tree {
+		if tb.Block.Header == nil {
+			files = append(files, tb.File)
+		}
+	}
+	return files, nil
+}
+
+// matchPattern reports whether s matches an ssh pattern, where '*' matches
+// any run of characters and '?' any single one. Case is ignored, as ssh does
+// for host names.
+func matchPattern(pattern, s string) bool {
+	pattern, s = strings.ToLower(pattern), strings.ToLower(s)
+	for pattern != "" {
+		switch pattern[0] {
+		case '*':
+			pattern = strings.TrimLeft(pattern, "*")
+			if pattern == "" {
+				return true
+			}
+			for i := range len(s) + 1 {
+				if matchPattern(pattern, s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if s == "" {
+				return false
+			}
+		default:
+			if s == "" || s[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return s == ""
+}
+
+// matchPatternList applies the patterns of a Host line, or of a
+// comma-separated Match list, to s: a matching negated pattern ("!pat")
+// rules s out, otherwise any matching plain pattern lets it in.
+func matchPatternList(patterns []string, s string) bool {
+	matched := false
+	for _, p := range patterns {
+		if negated, ok := strings.CutPrefix(p, "!"); ok {
+			if matchPattern(negated, s) {
+				return false
+			}
+		} else if matchPattern(p, s) {
+			matched = true
+		}
+	}
+	return matched
+}
+
+// isWildcardPattern reports whether p matches more than one literal name.
+func isWildcardPattern(p string) bool {
+	return strings.ContainsAny(p, "*?")
+}
+
+// includeMatches expands the arguments of an Include line into the files
+// they name, in sorted glob order.
+func includeMatches(args []string, baseDir, homeDir string) []string {
+	var out []string
+	for _, arg := range args {
+		pattern := expandHome(arg, homeDir)
+		if !filepath.IsAbs(pattern) && !strings.HasPrefix(arg, "~") {
+			pattern = filepath.Join(baseDir, arg)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			continue
+		}
+		out = append(out, matches...)
+	}
+	return out
+}
+
+// findHostFile returns the file, among configFile and the files it
+// includes, that holds the first Host block listing alias.
+func findHostFile(configFile, alias string) (string, bool) {
+	files, err := configFiles(configFile)
+	if err != nil {
+		return "", false
+	}
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			continue
+		}
+		if parseSSHConfig(data).findHost(alias) != nil {
+			return f, true
+		}
+	}
+	return "", false
+}
+
+// hasHeader reports whether configFile, or a file it includes, has a block
+// whose Host or Match line is header, ignoring case and quoting.
+func hasHeader(configFile, header string) bool {
+	want := parseConfigLine(header)
+	tree, err := configTree(configFile)
+	if err != nil {
+		return false
+	}
+	for _, tb := range tree {
+		h := tb.Block.Header
+		if h == nil || !strings.EqualFold(h.Keyword, want.Keyword) || len(h.Args) != len(want.Args) {
+			continue
+		}
+		same := true
+		for i := range h.Args {
+			same = same && strings.EqualFold(h.Args[i], want.Args[i])
+		}
+		if same {
+			return true
+		}
+	}
+	return false
+}
+
+// ensureInclude makes configFile include target unconditionally.
+func ensureInclude(configFile, target string) error {
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		return err
+	}
+	updated := addInclude(data, configFile, target)
+	if bytes.Equal(data, updated) {
+		return nil
+	}
+	return writeSSHFile(filepath.Dir(configFile), configFile, updated, 0o600)
+}
+
+// addInclude returns config, the contents of configFile, with an Include
+// line for target added at the top, unless a top-level Include already
+// covers target. target does not need to exist yet.
+func addInclude(config []byte, configFile, target string) []byte {
+	baseDir := filepath.Dir(configFile)
+	target = filepath.Clean(target)
+
+	cfg := parseSSHConfig(config)
+	for _, l := range cfg.Global.Lines {
+		if l.is("include") && includeCovers(l.Args, baseDir, filepath.Dir(baseDir), target) {
+			return config
+		}
+	}
+
+	arg := target
+	if rel, err := filepath.Rel(baseDir, target); err == nil && !strings.HasPrefix(rel, "..") {
+		arg = filepath.ToSlash(rel)
+	}
+	lines := []*configLine{parseConfigLine("Include " + quoteConfigArg(arg) + cfg.newline)}
+	if len(config) > 0 {
+		lines = append(lines, parseConfigLine(cfg.newline))
+	}
+	cfg.Global.Lines = append(lines, cfg.Global.Lines...)
+	return cfg.Bytes()
+}
+
+// includeCovers reports whether the arguments of an Include line match
+// target, whether or not target exists.
+func includeCovers(args []string, baseDir, homeDir, target string) bool {
+	for _, arg := range args {
+		pattern := expandHome(arg, homeDir)
+		if !filepath.IsAbs(pattern) && !strings.HasPrefix(arg, "~") {
+			pattern = filepath.Join(baseDir, arg)
+		}
+		if ok, err := filepath.Match(filepath.Clean(pattern), target); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
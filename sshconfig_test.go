@@ -0,0 +1,279 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSSHConfigRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{"empty", ""},
+		{"lf", "Host gh\n  HostName github.com\n  User git\n"},
+		{"crlf", "Host gh\r\n  HostName github.com\r\n\r\nHost *\r\n  AddKeysToAgent yes\r\n"},
+		{"no final newline", "Host gh\n  HostName github.com"},
+		{"keyword=value", "Host=gh\n\tHostName=github.com\n  Port = 443\n"},
+		{"quoting", "Host gh\n  IdentityFile \"~/.ssh/my key\"\n  ProxyCommand 'ssh -W %h:%p bastion'\n"},
+		{"comments", "# global\nUser me # trailing\n\n# next\nHost gh # alias\n  # inside\n  User git\n"},
+		{"match", "Match originalhost gh exec \"ping -c1 intranet\"\n  IdentityFile ~/.ssh/id_work\n"},
+		{"include", "Include config.d/*.conf\n\nHost gh\n  Include ~/.ssh/extra\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(parseSSHConfig([]byte(tt.config)).Bytes()); got != tt.config {
+				t.Errorf("round trip changed the config:\ngot  %q\nwant %q", got, tt.config)
+			}
+		})
+	}
+}
+
+func TestParseConfigLine(t *testing.T) {
+	tests := []struct {
+		raw     string
+		keyword string
+		args    []string
+	}{
+		{"Host gh other\n", "Host", []string{"gh", "other"}},
+		{"  HostName github.com\r\n", "HostName", []string{"github.com"}},
+		{"HostName=github.com\n", "HostName", []string{"github.com"}},
+		{"Port = 443\n", "Port", []string{"443"}},
+		{"\tUser\tgit\n", "User", []string{"git"}},
+		{"User git # comment\n", "User", []string{"git"}},
+		{"User git#notacomment\n", "User", []string{"git#notacomment"}},
+		{`IdentityFile "~/.ssh/my key"` + "\n", "IdentityFile", []string{"~/.ssh/my key"}},
+		{`IdentityFile '~/.ssh/my key'` + "\n", "IdentityFile", []string{"~/.ssh/my key"}},
+		{`IdentityFile ~/.ssh/my\ key` + "\n", "IdentityFile", []string{"~/.ssh/my key"}},
+		{`Match exec "test \"$X\" = 1"` + "\n", "Match", []string{"exec", `test "$X" = 1`}},
+		{"ForwardAgent\n", "ForwardAgent", nil},
+		{"# comment\n", "", nil},
+		{"   \n", "", nil},
+	}
+	for _, tt := range tests {
+		l := parseConfigLine(tt.raw)
+		if l.Keyword != tt.keyword || !reflect.DeepEqual(l.Args, tt.args) {
+			t.Errorf("parseConfigLine(%q) = %q %q, want %q %q", tt.raw, l.Keyword, l.Args, tt.keyword, tt.args)
+		}
+	}
+}
+
+func TestQuoteConfigArg(t *testing.T) {
+	for _, arg := range []string{
+		"github.com",
+		"~/.ssh/id_ed25519",
+		"~/.ssh/my key",
+		`C:\Users\me\.ssh\id_rsa`,
+		`say "hi"`,
+		"it's",
+		"#hash",
+		"tab\there",
+		"~/.ssh/ключ ü",
+		"",
+	} {
+		got := splitConfigArgs(quoteConfigArg(arg))
+		if len(got) != 1 || got[0] != arg {
+			t.Errorf("quoteConfigArg(%q) = %q, which reads back as %q", arg, quoteConfigArg(arg), got)
+		}
+	}
+}
+
+func TestSetOptionKeepsLineEndings(t *testing.T) {
+	tests := []struct {
+		name, config, want string
+	}{
+		{
+			"replace lf",
+			"Host gh\n  IdentityFile ~/.ssh/old\n  User git\n",
+			"Host gh\n  IdentityFile ~/.ssh/new\n  User git\n",
+		},
+		{
+			"replace crlf",
+			"Host gh\r\n  IdentityFile ~/.ssh/old\r\n  User git\r\n",
+			"Host gh\r\n  IdentityFile ~/.ssh/new\r\n  User git\r\n",
+		},
+		{
+			"append crlf",
+			"Host gh\r\n\tUser git\r\n\r\n# next\r\nHost other\r\n",
+			"Host gh\r\n\tUser git\r\n\tIdentityFile ~/.ssh/new\r\n\r\n# next\r\nHost other\r\n",
+		},
+		{
+			"append without final newline",
+			"Host gh\n  User git",
+			"Host gh\n  User git\n  IdentityFile ~/.ssh/new\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := parseSSHConfig([]byte(tt.config))
+			cfg.findHost("gh").setOption("IdentityFile", "~/.ssh/new", cfg.newline)
+			if got := string(cfg.Bytes()); got != tt.want {
+				t.Errorf("got  %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemoveHost(t *testing.T) {
+	tests := []struct {
+		name, config, alias, want string
+	}{
+		{
+			"whole block",
+			"Host a\n  User git\n\nHost gh\n  User git\n\n# keep\nHost b\n  User git\n",
+			"gh",
+			"Host a\n  User git\n\n# keep\nHost b\n  User git\n",
+		},
+		{
+			"one of several patterns",
+			"Host gh \"other host\"\n  User git\n",
+			"GH",
+			"Host \"other host\"\n  User git\n",
+		},
+		{
+			"host and match rule",
+			"Match originalhost gh exec \"on-vpn\"\r\n  User work\r\n\r\nHost gh\r\n  User git\r\n",
+			"gh",
+			"",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := parseSSHConfig([]byte(tt.config))
+			if _, ok := cfg.removeHost(tt.alias); !ok {
+				t.Fatalf("removeHost(%q) found nothing", tt.alias)
+			}
+			if got := string(cfg.Bytes()); got != tt.want {
+				t.Errorf("got  %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigTreeIncludes(t *testing.T) {
+	home := t.TempDir()
+	sshDir := filepath.Join(home, ".ssh")
+	write := func(rel, data string) string {
+		t.Helper()
+		path := filepath.Join(sshDir, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	configFile := write("config", "Include config.d/*.conf missing.conf\n\nHost gh\n  Include ~/.ssh/nested/inner\n  User git\n")
+	b := write("config.d/b.conf", "Host b\n")
+	a := write("config.d/a.conf", "Host a\n  Include config\n")
+	inner := write("nested/inner", "Port 443\n")
+
+	tree, err := configTree(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, tb := range tree {
+		name := "(global)"
+		if tb.Block.Header != nil {
+			name = tb.Block.Header.value()
+		}
+		parent := ""
+		if tb.Parent != nil {
+			parent = tb.Parent.value()
+		}
+		got = append(got, fmt.Sprintf("%s %s %s", filepath.Base(tb.File), name, parent))
+	}
+	want := []string{
+		"config (global) ",
+		"a.conf (global) ",
+		"a.conf a ",
+		"b.conf (global) ",
+		"b.conf b ",
+		"config gh ",
+		"inner (global) gh",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("configTree order:\ngot  %q\nwant %q", got, want)
+	}
+
+	files, err := configFiles(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{configFile, a, b, inner}; !reflect.DeepEqual(files, want) {
+		t.Errorf("configFiles = %q, want %q", files, want)
+	}
+}
+
+func TestConfigTreeIncludeDepth(t *testing.T) {
+	sshDir := filepath.Join(t.TempDir(), ".ssh")
+	if err := os.MkdirAll(sshDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	for _, depth := range []int{maxIncludeDepth, maxIncludeDepth + 1} {
+		for i := 0; i < depth; i++ {
+			data := fmt.Sprintf("Include f%d\n", i+1)
+			if err := os.WriteFile(filepath.Join(sshDir, fmt.Sprintf("f%d", i)), []byte(data), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := os.WriteFile(filepath.Join(sshDir, fmt.Sprintf("f%d", depth)), []byte("User git\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		_, err := configTree(filepath.Join(sshDir, "f0"))
+		if tooDeep := depth > maxIncludeDepth; (err != nil) != tooDeep {
+			t.Errorf("depth %d: err = %v, want error %v", depth, err, tooDeep)
+		}
+	}
+}
+
+func TestAddInclude(t *testing.T) {
+	sshDir := filepath.Join(t.TempDir(), ".ssh")
+	configFile := filepath.Join(sshDir, "config")
+	target := filepath.Join(sshDir, "config.d", "github-ssh-manager.conf")
+	tests := []struct {
+		name, config, want string
+	}{
+		{"empty", "", "Include config.d/github-ssh-manager.conf\n"},
+		{"before hosts", "# mine\r\nHost gh\r\n  User git\r\n", "Include config.d/github-ssh-manager.conf\r\n\r\n# mine\r\nHost gh\r\n  User git\r\n"},
+		{"covered by glob", "Include config.d/*.conf\n", "Include config.d/*.conf\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(addInclude([]byte(tt.config), configFile, target))
+			if !strings.HasPrefix(got, "Include ") || got != tt.want {
+				t.Errorf("got  %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchPatternList(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		host     string
+		want     bool
+	}{
+		{[]string{"gh"}, "GH", true},
+		{[]string{"*.example.com"}, "git.example.com", true},
+		{[]string{"gh-?"}, "gh-1", true},
+		{[]string{"gh-?"}, "gh-10", false},
+		{[]string{"a*b"}, "ac", false},
+		{[]string{"**"}, "", true},
+		{[]string{"*", "!gh"}, "gh", false},
+		{[]string{"*", "!gh"}, "other", true},
+		{[]string{"!gh"}, "other", false},
+	}
+	for _, tt := range tests {
+		if got := matchPatternList(tt.patterns, tt.host); got != tt.want {
+			t.Errorf("matchPatternList(%q, %q) = %v, want %v", tt.patterns, tt.host, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// keyNaming holds the templates for the comment, file name and GitHub title
+// of new keys. Placeholders are listed in templatePlaceholders.
+type keyNaming struct {
+	Comment  string
+	FileName string
+	Title    string
+}
+
+var defaultKeyNaming = keyNaming{
+	Comment:  "{label}@github",
+	FileName: "id_{algo}_{label}",
+	Title:    "{label}-{alias}",
+}
+
+// naming is the template set in effect. The UI replaces it when the user
+// saves new templates.
+var naming = defaultKeyNaming
+
+var templatePlaceholders = []string{"{label}", "{alias}", "{hostname}", "{user}", "{date}", "{algo}"}
+
+var placeholderPattern = regexp.MustCompile(`\{[^{}]*\}`)
+
+// templateVars are the values substituted into a template.
+type templateVars struct {
+	Label string
+	Alias string
+	Algo  keyAlgorithm
+	Date  time.Time
+}
+
+func newTemplateVars(label, alias string, algo keyAlgorithm) templateVars {
+	return templateVars{Label: label, Alias: alias, Algo: algo, Date: time.Now()}
+}
+
+// algoName is the short algorithm name used for {algo}: the file prefix
+// without its "id_".
+func algoName(algo keyAlgorithm) string {
+	return strings.TrimPrefix(algo.Prefix, "id_")
+}
+
+func renderTemplate(tmpl string, v templateVars) string {
+	return strings.NewReplacer(
+		"{label}", v.Label,
+		"{alias}", v.Alias,
+		"{hostname}", localHostname(),
+		"{user}", localUsername(),
+		"{date}", v.Date.Format("2006-01-02"),
+		"{algo}", algoName(v.Algo),
+	).Replace(tmpl)
+}
+
+func (n keyNaming) comment(v templateVars) string  { return renderTemplate(n.Comment, v) }
+func (n keyNaming) title(v templateVars) string    { return renderTemplate(n.Title, v) }
+func (n keyNaming) fileName(v templateVars) string { return renderTemplate(n.FileName, v) }
+
+// githubKeyTitle renders the GitHub title template for an existing public
+// key, taking {algo} from the key itself.
+func githubKeyTitle(label, alias, publicKey string) string {
+	v := newTemplateVars(label, alias, keyAlgorithm{})
+	if pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(publicKey)); err == nil {
+		if algo, err := algorithmForPublicKey(pub); err == nil {
+			v.Algo = algo
+		}
+	}
+	return naming.title(v)
+}
+
+func localHostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+func localUsername() string {
+	u, err := user.Current()
+	if err != nil {
+		return "unknown"
+	}
+	name := u.Username
+	if i := strings.LastIndexByte(name, '\\'); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
+
+// validate checks that every template only uses known placeholders and that
+// the file name template identifies the account and renders to a plain
+// file name.
+func (n keyNaming) validate() error {
+	for _, t := range []struct{ name, tmpl string }{
+		{"comment", n.Comment},
+		{"file name", n.FileName},
+		{"GitHub title", n.Title},
+	} {
+		if strings.TrimSpace(t.tmpl) == "" {
+			return fmt.Errorf("%s template must not be empty", t.name)
+		}
+		for _, p := range placeholderPattern.FindAllString(t.tmpl, -1) {
+			if !containsFold(templatePlaceholders, p) || p != strings.ToLower(p) {
+				return fmt.Errorf("%s template uses unknown placeholder %s", t.name, p)
+			}
+		}
+	}
+	if !strings.Contains(n.FileName, "{label}") {
+		return fmt.Errorf("file name template must contain {label}")
+	}
+	sample := n.fileName(newTemplateVars("label", "alias", keyAlgorithms[0]))
+	if !isPlainFileName(sample) || strings.HasSuffix(sample, ".pub") || strings.ContainsAny(sample, "*?[ ") {
+		return fmt.Errorf("file name template must render to a plain file name, got %q", sample)
+	}
+	return nil
+}
+
+// keyFileCandidates lists the paths in sshDir that may hold the key of
+// label under the current file name template, newest name first. Keys the
+// registry records for another label are left out, since an {alias} or
+// {date} next to the label can make one account's file name look like
+// another's.
+func keyFileCandidates(sshDir, label string) []string {
+	entries, err := os.ReadDir(sshDir)
+	if err != nil {
+		return nil
+	}
+	owner := map[string]string{}
+	if reg, err := loadKeyRegistry(sshDir); err == nil {
+		for l, rec := range reg {
+			owner[filepath.Clean(rec.KeyPath)] = l
+		}
+	}
+	var patterns []*regexp.Regexp
+	for _, prefix := range keyFilePrefixes {
+		patterns = append(patterns, keyFilePattern(label, prefix))
+	}
+
+	seen := map[string]bool{}
+	var paths []string
+	for _, e := range entries {
+		name := strings.TrimSuffix(e.Name(), ".pub")
+		path := filepath.Join(sshDir, name)
+		if e.IsDir() || seen[path] || strings.HasSuffix(name, ".rotating") {
+			continue
+		}
+		if l, ok := owner[path]; ok && l != label {
+			continue
+		}
+		for _, re := range patterns {
+			if re.MatchString(name) {
+				seen[path] = true
+				paths = append(paths, path)
+				break
+			}
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(paths)))
+	return paths
+}
+
+// keyFilePattern matches the file names the current template gives label's
+// keys for the algorithm prefix.
+func keyFilePattern(label, prefix string) *regexp.Regexp {
+	return keyFileRegexp(naming.FileName, prefix, regexp.QuoteMeta(label))
+}
+
+// keyFileRegexp turns the file name template tmpl into an anchored pattern,
+// with labelExpr standing in for {label}. {alias} and {date} are unknown
+// when looking a key up by label, so they match the values they can render
+// to.
+func keyFileRegexp(tmpl, prefix, labelExpr string) *regexp.Regexp {
+	v := templateVars{Algo: keyAlgorithm{Prefix: prefix}}
+	var b strings.Builder
+	b.WriteString("^")
+	last := 0
+	for _, loc := range placeholderPattern.FindAllStringIndex(tmpl, -1) {
+		b.WriteString(regexp.QuoteMeta(tmpl[last:loc[0]]))
+		switch p := tmpl[loc[0]:loc[1]]; p {
+		case "{label}":
+			b.WriteString(labelExpr)
+		case "{alias}":
+			b.WriteString(`[a-zA-Z0-9._-]{1,128}`)
+		case "{date}":
+			b.WriteString(`[0-9]{4}-[0-9]{2}-[0-9]{2}`)
+		default:
+			b.WriteString(regexp.QuoteMeta(renderTemplate(p, v)))
+		}
+		last = loc[1]
+	}
+	b.WriteString(regexp.QuoteMeta(tmpl[last:]))
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// keyFileLabel recovers the account label from the name of a key file made
+// under the current file name template, or "" if the name does not fit it.
+// When {alias} or {date} make the split ambiguous, the shortest label wins.
+func keyFileLabel(keyPath string) string {
+	name := filepath.Base(keyPath)
+	for _, prefix := range keyFilePrefixes {
+		m := keyFileRegexp(naming.FileName, prefix, `([a-zA-Z0-9._-]{1,64}?)`).FindStringSubmatch(name)
+		if m == nil || validateLabel(m[1]) != nil {
+			continue
+		}
+		// A template may repeat {label}; every copy must agree.
+		if keyFilePattern(m[1], prefix).MatchString(name) {
+			return m[1]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// useNaming makes n the template set in effect for the rest of the test.
+func useNaming(t *testing.T, fileName string) {
+	t.Helper()
+	old := naming
+	naming = keyNaming{Comment: defaultKeyNaming.Comment, FileName: fileName, Title: defaultKeyNaming.Title}
+	t.Cleanup(func() { naming = old })
+}
+
+func TestRenderTemplate(t *testing.T) {
+	v := templateVars{Label: "work", Alias: "gh-work", Algo: keyAlgorithms[3], Date: time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC)}
+	tests := []struct {
+		tmpl, want string
+	}{
+		{"{label}@github", "work@github"},
+		{"id_{algo}_{label}", "id_ecdsa_work"},
+		{"{label}-{alias}", "work-gh-work"},
+		{"{label}_{date}", "work_2026-03-04"},
+		{"{user}@{hostname}", localUsername() + "@" + localHostname()},
+		{"{label}{label}", "workwork"},
+		{"{unknown} {label}", "{unknown} work"},
+		{"no placeholders", "no placeholders"},
+	}
+	for _, tt := range tests {
+		if got := renderTemplate(tt.tmpl, v); got != tt.want {
+			t.Errorf("renderTemplate(%q) = %q, want %q", tt.tmpl, got, tt.want)
+		}
+	}
+}
+
+func TestKeyNamingValidate(t *testing.T) {
+	valid := defaultKeyNaming
+	tests := []struct {
+		name string
+		edit func(n *keyNaming)
+		ok   bool
+	}{
+		{"default", func(n *keyNaming) {}, true},
+		{"date and hostname", func(n *keyNaming) { n.FileName = "{label}_{hostname}_{date}" }, true},
+		{"regexp characters", func(n *keyNaming) { n.FileName = "key.{label}+(x)" }, true},
+		{"empty comment", func(n *keyNaming) { n.Comment = " " }, false},
+		{"unknown placeholder", func(n *keyNaming) { n.Title = "{label} {repo}" }, false},
+		{"upper case placeholder", func(n *keyNaming) { n.Comment = "{LABEL}" }, false},
+		{"file name without label", func(n *keyNaming) { n.FileName = "id_{algo}" }, false},
+		{"path separator", func(n *keyNaming) { n.FileName = "../{label}" }, false},
+		{"public key suffix", func(n *keyNaming) { n.FileName = "{label}.pub" }, false},
+		{"glob character", func(n *keyNaming) { n.FileName = "{label}*" }, false},
+		{"space", func(n *keyNaming) { n.FileName = "my {label}" }, false},
+	}
+	for _, tt := range tests {
+		n := valid
+		tt.edit(&n)
+		if err := n.validate(); (err == nil) != tt.ok {
+			t.Errorf("%s: validate() = %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestKeyFilePattern(t *testing.T) {
+	tests := []struct {
+		tmpl, label, prefix, name string
+		want                      bool
+	}{
+		{"id_{algo}_{label}", "work", "id_ed25519", "id_ed25519_work", true},
+		{"id_{algo}_{label}", "work", "id_rsa", "id_ed25519_work", false},
+		{"id_{algo}_{label}", "work", "id_ed25519", "id_ed25519_work.pub", false},
+		{"id_{algo}_{label}", "work", "id_ed25519", "id_ed25519_work_2", false},
+		{"id_{algo}_{label}", "work", "id_ed25519", "xid_ed25519_work", false},
+		{"{label}_{date}", "ops", "id_rsa", "ops_2025-01-02", true},
+		{"{label}_{date}", "ops", "id_rsa", "ops_2025-1-2", false},
+		{"{label}_{date}", "ops", "id_rsa", "ops_x_2025-01-02", false},
+		{"id_{algo}_{label}_{alias}", "work", "id_ecdsa", "id_ecdsa_work_gh-work", true},
+		{"id_{algo}_{label}_{alias}", "work", "id_ecdsa", "id_ecdsa_work_", false},
+		{"id_{algo}_{label}_{hostname}", "work", "id_ecdsa", "id_ecdsa_work_" + localHostname(), true},
+		{"key.{label}+(x)", "a.b", "id_rsa", "key.a.b+(x)", true},
+		{"key.{label}+(x)", "a.b", "id_rsa", "keyXa.b+(x)", false},
+		{"key.{label}+(x)", "a.b", "id_rsa", "key.aXb+(x)", false},
+		{"key.{label}+(x)", "a.b", "id_rsa", "key.a.bb+(x)", false},
+	}
+	for _, tt := range tests {
+		useNaming(t, tt.tmpl)
+		if got := keyFilePattern(tt.label, tt.prefix).MatchString(tt.name); got != tt.want {
+			t.Errorf("%q with label %q, prefix %s: match %q = %v, want %v", tt.tmpl, tt.label, tt.prefix, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestKeyFileLabel(t *testing.T) {
+	tests := []struct {
+		tmpl, name, want string
+	}{
+		{"id_{algo}_{label}", "id_ed25519_work", "work"},
+		{"id_{algo}_{label}", "/home/me/.ssh/id_rsa_my.team-1", "my.team-1"},
+		{"id_{algo}_{label}", "id_dsa_work", ""},
+		{"id_{algo}_{label}", "id_rsa", ""},
+		{"id_{algo}_{label}", "other_key", ""},
+		{"{label}_{date}", "ops_2025-01-02", "ops"},
+		{"{label}_{date}", "ops_2025", ""},
+		{"gh-{label}-{algo}", "gh-work-ecdsa", "work"},
+		{"{label}.{label}", "a.a", "a"},
+		{"{label}.{label}", "a.b", ""},
+		{"id_{algo}_{label}_{alias}", "id_ed25519_work_gh", "work"},
+		// Ambiguous: the shortest label that fits is taken.
+		{"id_{algo}_{label}_{alias}", "id_ed25519_work_2_gh", "work"},
+	}
+	for _, tt := range tests {
+		useNaming(t, tt.tmpl)
+		if got := keyFileLabel(tt.name); got != tt.want {
+			t.Errorf("%q: keyFileLabel(%q) = %q, want %q", tt.tmpl, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestKeyFileCandidates(t *testing.T) {
+	useNaming(t, "id_{algo}_{label}_{alias}")
+	sshDir := t.TempDir()
+	for _, name := range []string{
+		"id_ed25519_work_gh",
+		"id_ed25519_work_gh.pub",
+		"id_rsa_work_old.pub",
+		"id_ed25519_work_2_gh",
+		"id_ed25519_work_gh2.rotating",
+		"id_ed25519_workx_gh",
+		"id_ed25519_work_",
+	} {
+		if err := os.WriteFile(filepath.Join(sshDir, name), []byte("x"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(sshDir, "id_ecdsa_work_dir"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	reg := keyRegistry{}
+	reg.recordCreated("work_2", filepath.Join(sshDir, "id_ed25519_work_2_gh"), time.Now())
+	if err := reg.save(sshDir); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		label string
+		want  []string
+	}{
+		// id_ed25519_work_2_gh fits "work" too, but the registry
+		// records it for work_2.
+		{"work", []string{"id_rsa_work_old", "id_ed25519_work_gh"}},
+		{"work_2", []string{"id_ed25519_work_2_gh"}},
+		{"workx", []string{"id_ed25519_workx_gh"}},
+		{"missing", nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, path := range keyFileCandidates(sshDir, tt.label) {
+			got = append(got, filepath.Base(path))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("keyFileCandidates(%q) = %q, want %q", tt.label, got, tt.want)
+		}
+	}
+}
@@ -1,11 +1,16 @@
 package main
 
 import (
+	"crypto"
+	"errors"
 	"fmt"
+	"io"
 	"net/url"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -32,15 +37,93 @@ func buildUI(a fyne.App, w fyne.Window, sshDir string) {
 	hostEntry := widget.NewEntry()
 	hostEntry.SetPlaceHolder("github-personal")
 
+	matchEntry := widget.NewEntry()
+	matchEntry.SetPlaceHolder(`optional, e.g. exec "ping -c1 -W1 intranet.example.com"`)
+	port443Check := widget.NewCheck("Connect over port 443 (ssh.github.com)", nil)
+
 	tokenEntry := widget.NewPasswordEntry()
 	tokenEntry.SetPlaceHolder("GitHub token (scope: admin:public_key, repo optional)")
 
+	algorithmSelect := widget.NewSelect(keyAlgorithmNames(), nil)
+	algorithmSelect.SetSelected(keyAlgorithms[0].Name)
+
+	backendSelect := widget.NewSelect(keygenBackends(), nil)
+	backendSelect.SetSelected(keygenBuiltin)
+
+	passphraseEntry := widget.NewPasswordEntry()
+	passphraseEntry.SetPlaceHolder("Key passphrase (min 8 characters)")
+
+	confirmEntry := widget.NewPasswordEntry()
+	confirmEntry.SetPlaceHolder("Repeat passphrase")
+
+	strengthBar := widget.NewProgressBar()
+	strengthBar.Max = 4
+	strengthLabel := "None"
+	strengthBar.TextFormatter = func() string { return strengthLabel }
+	passphraseEntry.OnChanged = func(text string) {
+		score, label := passphraseStrength(text)
+		strengthLabel = label
+		strengthBar.SetValue(float64(score))
+	}
+
+	roundsEntry := widget.NewEntry()
+	roundsEntry.SetText(strconv.Itoa(defaultKDFRounds))
+
+	noPassphraseCheck := widget.NewCheck("Create key without passphrase (not recommended)", func(checked bool) {
+		if checked {
+			passphraseEntry.Disable()
+			confirmEntry.Disable()
+			roundsEntry.Disable()
+		} else {
+			passphraseEntry.Enable()
+			confirmEntry.Enable()
+			roundsEntry.Enable()
+		}
+	})
+
 	themeSelect := widget.NewSelect([]string{"System (Default)", "Light", "Dark"}, func(choice string) {
 		applyThemeChoice(a, choice)
 		log.info("Theme changed to: " + choice)
 	})
 	themeSelect.SetSelected("System (Default)")
 
+	prefs := a.Preferences()
+	saved := keyNaming{
+		Comment:  prefs.StringWithFallback("template.comment", defaultKeyNaming.Comment),
+		FileName: prefs.StringWithFallback("template.filename", defaultKeyNaming.FileName),
+		Title:    prefs.StringWithFallback("template.title", defaultKeyNaming.Title),
+	}
+	if err := saved.validate(); err != nil {
+		log.warn("Ignoring saved naming templates: " + err.Error())
+	} else {
+		naming = saved
+	}
+
+	includeCheck := widget.NewCheck("Keep managed entries in config.d/github-ssh-manager.conf", func(checked bool) {
+		prefs.SetBool("config.includeMode", checked)
+	})
+	includeCheck.SetChecked(prefs.Bool("config.includeMode"))
+	previewCheck := widget.NewCheck("Preview changes to SSH config and known_hosts", func(checked bool) {
+		prefs.SetBool("config.previewChanges", checked)
+	})
+	previewCheck.SetChecked(prefs.BoolWithFallback("config.previewChanges", true))
+
+	// managedConfig is the file new Host entries are written to.
+	managedConfig := func() string {
+		if includeCheck.Checked {
+			return managedConfigFile(sshDir)
+		}
+		return configFile
+	}
+	// hostConfig is the file that defines alias, following Include lines,
+	// or the main config if no file does.
+	hostConfig := func(alias string) string {
+		if file, ok := findHostFile(configFile, alias); ok {
+			return file
+		}
+		return configFile
+	}
+
 	status := widget.NewRichTextFromMarkdown("`Ready`")
 
 	setStatus := func(message string) {
@@ -48,6 +131,47 @@ func buildUI(a fyne.App, w fyne.Window, sshDir string) {
 		status.Refresh()
 	}
 
+	// trackKey applies update to the key registry and saves it. Tracking is
+	// best effort, so failures are only logged.
+	trackKey := func(update func(reg keyRegistry)) {
+		reg, err := loadKeyRegistry(sshDir)
+		if err == nil {
+			update(reg)
+			err = reg.save(sshDir)
+		}
+		if err != nil {
+			log.warn("Could not update key age records: " + err.Error())
+		}
+	}
+
+	checkKeyAges := func() {
+		reg, err := loadKeyRegistry(sshDir)
+		if err != nil {
+			log.warn("Could not read key age records: " + err.Error())
+			return
+		}
+		if added, err := reg.adoptUntracked(sshDir, configFile); err == nil && added {
+			if err := reg.save(sshDir); err != nil {
+				log.warn("Could not save key age records: " + err.Error())
+			}
+		}
+		expired, expiring := 0, 0
+		for _, k := range reg.keyAges(time.Now()) {
+			switch k.state() {
+			case "expired":
+				expired++
+				log.warn(fmt.Sprintf("Key for %s is %d days old, past its %d-day limit: rotate it", k.Label, k.AgeDays, k.Record.maxAge()))
+			case "expiring soon":
+				expiring++
+				log.warn(fmt.Sprintf("Key for %s expires in %d days", k.Label, k.DaysLeft))
+			}
+		}
+		if expired+expiring > 0 {
+			setStatus(fmt.Sprintf("%d key(s) expired, %d expiring soon", expired, expiring))
+		}
+	}
+	checkKeyAges()
+
 	validateInputs := func(requirePAT bool) (string, string, string, error) {
 		label := strings.TrimSpace(labelEntry.Text)
 		alias := strings.TrimSpace(hostEntry.Text)
@@ -67,180 +191,1722 @@ func buildUI(a fyne.App, w fyne.Window, sshDir string) {
 		return label, alias, token, nil
 	}
 
-	generateBtn := widget.NewButtonWithIcon("Generate Key", theme.DocumentCreateIcon(), func() {
-		label, alias, _, err := validateInputs(false)
+	// readMatchRule returns the Match criteria new entries for alias are
+	// generated under, or "" for a plain Host entry.
+	readMatchRule := func(alias string) (string, error) {
+		rule := strings.TrimSpace(matchEntry.Text)
+		if rule == "" {
+			return "", nil
+		}
+		if _, err := matchHeader(alias, rule); err != nil {
+			return "", fmt.Errorf("invalid Match rule: %w", err)
+		}
+		return rule, nil
+	}
+
+	readKeyOptions := func(label string) (keyOptions, error) {
+		opts := keyOptions{Algorithm: lookupKeyAlgorithm(algorithmSelect.Selected), Backend: backendSelect.Selected}
+		if noPassphraseCheck.Checked {
+			log.warn("Passphrase opt-out: key for " + label + " will be stored unencrypted")
+			return opts, nil
+		}
+		if err := validatePassphrase(passphraseEntry.Text, confirmEntry.Text); err != nil {
+			return opts, err
+		}
+		rounds, err := parseKDFRounds(roundsEntry.Text)
+		if err != nil {
+			return opts, err
+		}
+		opts.Passphrase = passphraseEntry.Text
+		opts.KDFRounds = rounds
+		return opts, nil
+	}
+
+	// confirmFileChanges shows the diff of changes and calls apply once the
+	// user accepts, or straight away when previews are turned off.
+	confirmFileChanges := func(changes []fileChange, apply func()) {
+		var diffs []string
+		for _, c := range changes {
+			if d := c.diff(); d != "" {
+				diffs = append(diffs, d)
+			}
+		}
+		if len(diffs) == 0 || !previewCheck.Checked {
+			apply()
+			return
+		}
+		diffText := widget.NewTextGridFromString(strings.Join(diffs, "\n"))
+		diffScroll := container.NewScroll(diffText)
+		diffScroll.SetMinSize(fyne.NewSize(640, 320))
+		dontAsk := widget.NewCheck("Don't ask again", nil)
+		body := container.NewBorder(widget.NewLabel("The following changes will be written. Each file is backed up first."), dontAsk, nil, nil, diffScroll)
+		dialog.ShowCustomConfirm("Review Changes", "Apply", "Cancel", body, func(ok bool) {
+			if !ok {
+				log.warn("Changes cancelled; no files were written")
+				setStatus("Cancelled")
+				return
+			}
+			if dontAsk.Checked {
+				previewCheck.SetChecked(false)
+				log.info("Change previews turned off; re-enable them under Account Setup")
+			}
+			apply()
+		}, w)
+	}
+
+	// switchToPort443 rewrites alias's block to use ssh.github.com on port
+	// 443, adds that host's keys to known_hosts and runs done once written.
+	switchToPort443 := func(alias string, done func()) {
+		file := hostConfig(alias)
+		before, err := os.ReadFile(file)
+		if err != nil {
+			dialog.ShowError(err, w)
+			log.err("Failed to read SSH config: " + err.Error())
+			return
+		}
+		after, err := setHostPort443(before, alias)
+		if err != nil {
+			dialog.ShowError(err, w)
+			log.err(err.Error())
+			return
+		}
+		changes, err := gitHubKnownHostChanges(sshDir, true)
+		if err != nil {
+			dialog.ShowError(err, w)
+			log.err("Could not update known_hosts: " + err.Error())
+			return
+		}
+		changes = append(changes, fileChange{Path: file, Before: before, After: after, Perm: 0o600})
+		confirmFileChanges(changes, func() {
+			if err := applyFileChanges(sshDir, changes); err != nil {
+				dialog.ShowError(err, w)
+				log.err("Failed to update SSH config: " + err.Error())
+				setStatus("Failed")
+				return
+			}
+			log.success(alias + " now connects to ssh.github.com on port 443")
+			done()
+		})
+	}
+
+	// bindAlias runs the post-key steps shared by Generate and Import: it makes
+	// sure GitHub is in known_hosts and writes the Host block for alias, or
+	// a Match block when matchRule is set, after the changes have been
+	// confirmed. done runs once they are written.
+	bindAlias := func(alias, keyPath, matchRule string, done func()) {
+		var changes []fileChange
+		port443 := port443Check.Checked
+		knownHost := "github.com"
+		if port443 {
+			knownHost = gitHubSSH443Host
+		}
+		knownHostChanges, knownHostErr := gitHubKnownHostChanges(sshDir, port443)
+		if knownHostErr != nil {
+			log.warn("Could not update known_hosts: " + knownHostErr.Error())
+		}
+		changes = append(changes, knownHostChanges...)
+
+		if err := ensureConfigFile(configFile); err != nil {
+			dialog.ShowError(err, w)
+			log.err("Failed to update SSH config: " + err.Error())
+			setStatus("Failed")
+			return
+		}
+		// An existing Host entry is left alone, so port 443 is offered
+		// separately for it.
+		offer443 := false
+		if port443 && matchRule == "" {
+			if data, err := os.ReadFile(hostConfig(alias)); err == nil {
+				if opts, ok := hostBlockOptions(data, alias); ok {
+					offer443 = opts["port"] != gitHubSSH443Port || !strings.EqualFold(opts["hostname"], gitHubSSH443Host)
+				}
+			}
+		}
+		configChanges, err := sshConfigEntryChanges(configFile, managedConfig(), alias, keyPath, matchRule, port443)
+		if err != nil {
+			dialog.ShowError(err, w)
+			log.err("Failed to update SSH config: " + err.Error())
+			setStatus("Failed")
+			return
+		}
+		changes = append(changes, configChanges...)
+
+		confirmFileChanges(changes, func() {
+			if err := applyFileChanges(sshDir, changes); err != nil {
+				dialog.ShowError(err, w)
+				log.err("Failed to update SSH config: " + err.Error())
+				setStatus("Failed")
+				return
+			}
+			if knownHostErr == nil {
+				log.success(knownHost + " present in known_hosts")
+			}
+			log.success("SSH config updated for host " + alias)
+			if !offer443 {
+				done()
+				return
+			}
+			log.warn("Host " + alias + " already existed and was left as is; it does not use port 443")
+			msg := "Host " + alias + " already existed, so its entry was not changed.\n\nSwitch it to ssh.github.com on port 443?"
+			dialog.ShowConfirm("Port 443", msg, func(ok bool) {
+				if ok {
+					switchToPort443(alias, done)
+					return
+				}
+				done()
+			}, w)
+		})
+	}
+
+	generateBtn := widget.NewButtonWithIcon("Generate Key", theme.DocumentCreateIcon(), func() {
+		label, alias, _, err := validateInputs(false)
+		if err != nil {
+			dialog.ShowError(err, w)
+			log.err(err.Error())
+			return
+		}
+
+		matchRule, err := readMatchRule(alias)
+		if err != nil {
+			dialog.ShowError(err, w)
+			log.err(err.Error())
+			return
+		}
+		opts, err := readKeyOptions(label)
+		if err != nil {
+			dialog.ShowError(err, w)
+			log.err(err.Error())
+			return
+		}
+
+		setStatus("Generating key pair")
+		keyPath, err := generateKeyPair(sshDir, label, alias, opts)
+		passphraseEntry.SetText("")
+		confirmEntry.SetText("")
+		if err != nil {
+			dialog.ShowError(err, w)
+			log.err(err.Error())
+			setStatus("Failed")
+			return
+		}
+		if opts.Passphrase != "" {
+			log.success(fmt.Sprintf("SSH key generated: %s (encrypted, %d KDF rounds)", keyPath, opts.KDFRounds))
+		} else {
+			log.success("SSH key generated: " + keyPath)
+		}
+		trackKey(func(reg keyRegistry) { reg.recordCreated(label, keyPath, time.Now()) })
+
+		bindAlias(alias, keyPath, matchRule, func() {
+			setStatus("Key generated and config updated")
+			dialog.ShowInformation("Success", "SSH key created and SSH config updated.", w)
+		})
+	})
+	generateBtn.Importance = widget.HighImportance
+
+	// withManagedKey loads the private key for label, asking for its
+	// passphrase first if it is encrypted, and hands it to fn.
+	var withManagedKey func(label, passphrase string, fn func(key crypto.Signer, comment, keyPath, passphrase string))
+	withManagedKey = func(label, passphrase string, fn func(key crypto.Signer, comment, keyPath, passphrase string)) {
+		key, comment, keyPath, err := loadManagedKey(sshDir, label, passphrase)
+		if isPassphraseMissing(err) {
+			showPassphrasePrompt(w, "Enter the passphrase for "+keyPath, func(p string) {
+				withManagedKey(label, p, fn)
+			})
+			return
+		}
+		if err != nil {
+			dialog.ShowError(err, w)
+			log.err(err.Error())
+			return
+		}
+		fn(key, comment, keyPath, passphrase)
+	}
+
+	// showPassphraseForm asks for a new passphrase for the key at keyPath and
+	// re-encrypts it. With allowRemove the user may also store the key
+	// unencrypted. done runs after the key was written.
+	showPassphraseForm := func(title string, key crypto.Signer, comment, keyPath, oldPassphrase string, allowRemove bool, done func()) {
+		newEntry := widget.NewPasswordEntry()
+		newConfirm := widget.NewPasswordEntry()
+		newRounds := widget.NewEntry()
+		newRounds.SetText(strconv.Itoa(defaultKDFRounds))
+		removeCheck := widget.NewCheck("Remove passphrase (store key unencrypted)", func(checked bool) {
+			if checked {
+				newEntry.Disable()
+				newConfirm.Disable()
+				newRounds.Disable()
+			} else {
+				newEntry.Enable()
+				newConfirm.Enable()
+				newRounds.Enable()
+			}
+		})
+
+		items := []*widget.FormItem{
+			widget.NewFormItem("Key", widget.NewLabel(keyPath)),
+			widget.NewFormItem("New Passphrase", newEntry),
+			widget.NewFormItem("Confirm", newConfirm),
+			widget.NewFormItem("KDF Rounds", newRounds),
+		}
+		if allowRemove {
+			items = append(items, widget.NewFormItem("", removeCheck))
+		}
+		d := dialog.NewForm(title, "Save", "Cancel", items, func(ok bool) {
+			if !ok {
+				return
+			}
+			passphrase, rounds := "", 0
+			if !removeCheck.Checked {
+				if err := validatePassphrase(newEntry.Text, newConfirm.Text); err != nil {
+					dialog.ShowError(err, w)
+					log.err(err.Error())
+					return
+				}
+				r, err := parseKDFRounds(newRounds.Text)
+				if err != nil {
+					dialog.ShowError(err, w)
+					log.err(err.Error())
+					return
+				}
+				passphrase, rounds = newEntry.Text, r
+			}
+
+			if err := changeKeyPassphrase(keyPath, key, comment, passphrase, rounds); err != nil {
+				dialog.ShowError(fmt.Errorf("passphrase change failed: %w", err), w)
+				log.err("Passphrase change failed: " + err.Error())
+				return
+			}
+			switch {
+			case passphrase == "":
+				log.warn("Passphrase removed: " + keyPath + " is now stored unencrypted")
+			case oldPassphrase == "":
+				log.success(fmt.Sprintf("Passphrase added to %s (%d KDF rounds)", keyPath, rounds))
+			default:
+				log.success(fmt.Sprintf("Passphrase changed for %s (%d KDF rounds)", keyPath, rounds))
+			}
+			setStatus("Passphrase updated")
+			done()
+		}, w)
+		d.Resize(fyne.NewSize(560, 320))
+		d.Show()
+	}
+
+	// withPublicKey reads the public key of label and hands it to fn. If only
+	// the private key exists, the public key is derived from it and the user
+	// is offered to write the missing .pub back.
+	withPublicKey := func(label string, fn func(pub string)) {
+		pub, err := readPublicKey(sshDir, label)
+		if err == nil {
+			fn(pub)
+			return
+		}
+		if !errors.Is(err, errPublicKeyMissing) {
+			dialog.ShowError(err, w)
+			log.err(err.Error())
+			return
+		}
+		log.warn(err.Error() + "; deriving it from the private key")
+		withManagedKey(label, "", func(key crypto.Signer, comment, keyPath, _ string) {
+			line, err := derivePublicKeyLine(key, comment)
+			if err != nil {
+				dialog.ShowError(err, w)
+				log.err(err.Error())
+				return
+			}
+			dialog.ShowConfirm("Public Key Missing", fmt.Sprintf("%s.pub is missing and was derived from the private key.\n\nWrite it back with permissions 0644?", keyPath), func(ok bool) {
+				if ok {
+					if err := writePublicKeyFile(keyPath, line); err != nil {
+						dialog.ShowError(err, w)
+						log.err("Could not write public key: " + err.Error())
+					} else {
+						log.success("Public key restored: " + keyPath + ".pub")
+					}
+				}
+				fn(strings.TrimSpace(line))
+			}, w)
+		})
+	}
+
+	showPublicBtn := widget.NewButtonWithIcon("Show Public Key", theme.VisibilityIcon(), func() {
+		label := strings.TrimSpace(labelEntry.Text)
+		if err := validateLabel(label); err != nil {
+			dialog.ShowError(err, w)
+			log.err(err.Error())
+			return
+		}
+
+		withPublicKey(label, func(pub string) {
+			keyPath, _ := findKeyBasePath(sshDir, label)
+			info, err := describePublicKey(pub)
+			if err != nil {
+				dialog.ShowError(err, w)
+				log.err(err.Error())
+				return
+			}
+
+			pubText := widget.NewTextGridFromString(pub)
+			pubText.Scroll = fyne.ScrollBoth
+			pubScroll := container.NewScroll(pubText)
+			pubScroll.SetMinSize(fyne.NewSize(0, 80))
+
+			copyBtn := widget.NewButtonWithIcon("Copy", theme.ContentCopyIcon(), func() {
+				a.Clipboard().SetContent(pub)
+				log.success("Public key copied to clipboard")
+			})
+
+			copyField := func(name, value string) fyne.CanvasObject {
+				return widget.NewButtonWithIcon("", theme.ContentCopyIcon(), func() {
+					a.Clipboard().SetContent(value)
+					log.success(name + " copied to clipboard")
+				})
+			}
+			details := container.New(layout.NewFormLayout())
+			for _, field := range []struct{ name, value string }{
+				{"Type", info.Type},
+				{"Bits", strconv.Itoa(info.Bits)},
+				{"Comment", info.Comment},
+				{"SHA256", info.SHA256},
+				{"MD5", "MD5:" + info.MD5},
+			} {
+				value := widget.NewLabel(field.value)
+				value.TextStyle.Monospace = true
+				details.Add(widget.NewLabel(field.name))
+				details.Add(container.NewBorder(nil, nil, nil, copyField(field.name, field.value), value))
+			}
+
+			art := widget.NewTextGridFromString(info.RandomArt)
+			artBox := container.NewHBox(art, container.NewVBox(copyField("Randomart", info.RandomArt)))
+
+			body := container.NewBorder(
+				container.NewVBox(
+					widget.NewLabelWithStyle("Public key for "+label, fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+					widget.NewLabel(keyPath+".pub"),
+					widget.NewLabel("Add this to GitHub -> SSH and GPG keys; GitHub lists it by its SHA256 fingerprint"),
+					widget.NewSeparator(),
+					details,
+					artBox,
+					widget.NewSeparator(),
+				),
+				container.NewHBox(layout.NewSpacer(), copyBtn),
+				nil,
+				nil,
+				pubScroll,
+			)
+			d := dialog.NewCustom("Public Key", "Close", body, w)
+			d.Resize(fyne.NewSize(820, 640))
+			d.Show()
+		})
+	})
+
+	uploadBtn := widget.NewButtonWithIcon("Upload to GitHub", theme.UploadIcon(), func() {
+		label, alias, token, err := validateInputs(true)
+		if err != nil {
+			dialog.ShowError(err, w)
+			log.err(err.Error())
+			return
+		}
+
+		withPublicKey(label, func(pub string) {
+			setStatus("Uploading key to GitHub")
+			resp, err := uploadKeyToGitHub(token, githubKeyTitle(label, alias, pub), pub)
+			if err != nil {
+				msg := err.Error()
+				if resp != nil && resp.Message != "" {
+					msg = resp.Message
+				}
+				dialog.ShowError(fmt.Errorf("GitHub upload failed: %s", msg), w)
+				log.err("GitHub upload failed: " + msg)
+				setStatus("Upload failed")
+				return
+			}
+
+			log.success(fmt.Sprintf("Key uploaded to GitHub (ID: %d)", resp.ID))
+			trackKey(func(reg keyRegistry) { reg.recordUploaded(label, time.Now()) })
+			setStatus("Key uploaded")
+			tokenEntry.SetText("")
+			dialog.ShowInformation("Uploaded", fmt.Sprintf("Key uploaded successfully.\nTitle: %s\nID: %d", resp.Title, resp.ID), w)
+		})
+	})
+	uploadBtn.Importance = widget.HighImportance
+
+	var runSSHTest func(alias string)
+	runSSHTest = func(alias string) {
+		setStatus("Testing SSH connection")
+		output, err := testSSHConnection(alias)
+		if err != nil {
+			log.err(output)
+			setStatus("SSH test failed")
+			if !isPort22Timeout(output) {
+				dialog.ShowError(fmt.Errorf("%s", output), w)
+				return
+			}
+			msg := "The connection to port 22 timed out. The network may block SSH.\n\n" +
+				"Switch " + alias + " to ssh.github.com on port 443 and test again?"
+			dialog.ShowConfirm("Port 22 Blocked", msg, func(ok bool) {
+				if ok {
+					switchToPort443(alias, func() { runSSHTest(alias) })
+				}
+			}, w)
+			return
+		}
+		log.success("SSH connection verified for " + alias)
+		setStatus("SSH test passed")
+		dialog.ShowInformation("Connection OK", output, w)
+	}
+
+	testBtn := widget.NewButtonWithIcon("Test SSH", theme.ConfirmIcon(), func() {
+		alias := strings.TrimSpace(hostEntry.Text)
+		if err := validateHostAlias(alias); err != nil {
+			dialog.ShowError(err, w)
+			log.err(err.Error())
+			return
+		}
+		runSSHTest(alias)
+	})
+
+	importBtn := widget.NewButtonWithIcon("Import Key", theme.FolderOpenIcon(), func() {
+		label, alias, _, err := validateInputs(false)
+		if err != nil {
+			dialog.ShowError(err, w)
+			log.err(err.Error())
+			return
+		}
+		matchRule, err := readMatchRule(alias)
+		if err != nil {
+			dialog.ShowError(err, w)
+			log.err(err.Error())
+			return
+		}
+
+		var importData func(data []byte, source, passphrase string)
+		importData = func(data []byte, source, passphrase string) {
+			keyPath, err := importPrivateKey(sshDir, label, alias, data, passphrase)
+			if isPassphraseMissing(err) {
+				showPassphrasePrompt(w, "Enter the passphrase for "+source, func(p string) {
+					importData(data, source, p)
+				})
+				return
+			}
+			if err != nil {
+				dialog.ShowError(fmt.Errorf("import failed: %w", err), w)
+				log.err("Key import failed: " + err.Error())
+				setStatus("Import failed")
+				return
+			}
+			log.success("SSH key imported from " + source + ": " + keyPath)
+			trackKey(func(reg keyRegistry) { reg.recordCreated(label, keyPath, time.Now()) })
+
+			bindAlias(alias, keyPath, matchRule, func() {
+				setStatus("Key imported and config updated")
+				dialog.ShowInformation("Imported", "SSH key imported and SSH config updated.", w)
+			})
+		}
+
+		openDialog := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+			if err != nil {
+				dialog.ShowError(err, w)
+				return
+			}
+			if reader == nil {
+				return
+			}
+			defer reader.Close()
+			data, err := io.ReadAll(reader)
+			if err != nil {
+				dialog.ShowError(err, w)
+				log.err("Cannot read key file: " + err.Error())
+				return
+			}
+			importData(data, reader.URI().Path(), "")
+		}, w)
+		openDialog.Show()
+	})
+
+	exportBtn := widget.NewButtonWithIcon("Export Key", theme.DocumentSaveIcon(), func() {
+		label := strings.TrimSpace(labelEntry.Text)
+		if err := validateLabel(label); err != nil {
+			dialog.ShowError(err, w)
+			log.err(err.Error())
+			return
+		}
+
+		withManagedKey(label, "", func(key crypto.Signer, comment, keyPath, _ string) {
+			formatSelect := widget.NewSelect(exportFormats, nil)
+			formatSelect.SetSelected(exportPPK)
+			ppkPassEntry := widget.NewPasswordEntry()
+			ppkPassEntry.SetPlaceHolder("Leave empty for an unencrypted PPK")
+			formatSelect.OnChanged = func(format string) {
+				if format == exportPPK {
+					ppkPassEntry.Enable()
+				} else {
+					ppkPassEntry.Disable()
+				}
+			}
+			note := widget.NewLabel("PKCS#8 exports are written unencrypted. Store them carefully.")
+			note.Wrapping = fyne.TextWrapWord
+
+			items := []*widget.FormItem{
+				widget.NewFormItem("Key", widget.NewLabel(keyPath)),
+				widget.NewFormItem("Format", formatSelect),
+				widget.NewFormItem("PPK Passphrase", ppkPassEntry),
+				widget.NewFormItem("", note),
+			}
+			d := dialog.NewForm("Export Key", "Export", "Cancel", items, func(ok bool) {
+				if !ok {
+					return
+				}
+				format := formatSelect.Selected
+				data, err := exportKey(key, comment, format, ppkPassEntry.Text)
+				if err != nil {
+					dialog.ShowError(err, w)
+					log.err("Key export failed: " + err.Error())
+					return
+				}
+				saveDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+					if err != nil {
+						dialog.ShowError(err, w)
+						return
+					}
+					if writer == nil {
+						return
+					}
+					defer writer.Close()
+					if _, err := writer.Write(data); err != nil {
+						dialog.ShowError(err, w)
+						log.err("Key export failed: " + err.Error())
+						return
+					}
+					if format != exportRFC4716 && runtime.GOOS != "windows" {
+						_ = os.Chmod(writer.URI().Path(), 0o600)
+					}
+					log.success(fmt.Sprintf("Key exported as %s: %s", format, writer.URI().Path()))
+				}, w)
+				saveDialog.SetFileName(exportFileName(keyPath, format))
+				saveDialog.Show()
+			}, w)
+			d.Resize(fyne.NewSize(560, 320))
+			d.Show()
+		})
+	})
+
+	changePassBtn := widget.NewButtonWithIcon("Change Passphrase", theme.AccountIcon(), func() {
+		label := strings.TrimSpace(labelEntry.Text)
+		if err := validateLabel(label); err != nil {
+			dialog.ShowError(err, w)
+			log.err(err.Error())
+			return
+		}
+
+		withManagedKey(label, "", func(key crypto.Signer, comment, keyPath, oldPassphrase string) {
+			showPassphraseForm("Change Passphrase", key, comment, keyPath, oldPassphrase, true, func() {})
+		})
+	})
+
+	rotateBtn := widget.NewButtonWithIcon("Rotate Key", theme.ViewRefreshIcon(), func() {
+		label, alias, token, err := validateInputs(true)
+		if err != nil {
+			dialog.ShowError(err, w)
+			log.err(err.Error())
+			return
+		}
+		opts, err := readKeyOptions(label)
+		if err != nil {
+			dialog.ShowError(err, w)
+			log.err(err.Error())
+			return
+		}
+
+		msg := fmt.Sprintf("Rotate the key for %s?\n\nA new %s key will be generated, uploaded and tested against %s.\nThe old key is then archived locally and deleted from GitHub.", label, opts.Algorithm.Name, alias)
+		dialog.ShowConfirm("Rotate Key", msg, func(ok bool) {
+			if !ok {
+				return
+			}
+			// The old public key identifies the key to delete from GitHub; it
+			// is derived from the private key if the .pub is gone.
+			withPublicKey(label, func(oldPub string) {
+				setStatus("Rotating key")
+				log.info("Starting key rotation for " + label)
+				result, err := rotateKey(rotationRequest{
+					SSHDir:       sshDir,
+					ConfigFile:   hostConfig(alias),
+					Label:        label,
+					Alias:        alias,
+					Token:        token,
+					OldPublicKey: oldPub,
+					Options:      opts,
+				}, log.info)
+				passphraseEntry.SetText("")
+				confirmEntry.SetText("")
+				tokenEntry.SetText("")
+				if err != nil {
+					dialog.ShowError(fmt.Errorf("key rotation failed: %w", err), w)
+					log.err("Key rotation failed: " + err.Error())
+					setStatus("Rotation failed")
+					return
+				}
+				log.success("Key rotated for " + alias + ": " + result.KeyPath)
+				trackKey(func(reg keyRegistry) {
+					reg.recordCreated(label, result.KeyPath, time.Now())
+					reg.recordUploaded(label, time.Now())
+				})
+				setStatus("Key rotated")
+				dialog.ShowInformation("Key Rotated", fmt.Sprintf("New key: %s\nGitHub ID: %d\nOld key archived to: %s", result.KeyPath, result.GitHubID, result.ArchiveDir), w)
+			})
+		}, w)
+	})
+
+	removeBtn := widget.NewButtonWithIcon("Remove Account", theme.DeleteIcon(), func() {
+		label, alias, token, err := validateInputs(false)
+		if err != nil {
+			dialog.ShowError(err, w)
+			log.err(err.Error())
+			return
+		}
+
+		githubCheck := widget.NewCheck("Also delete the key from GitHub", nil)
+		githubCheck.SetChecked(token != "")
+		dialog.ShowForm("Remove Account", "Review", "Cancel", []*widget.FormItem{
+			widget.NewFormItem("", githubCheck),
+		}, func(ok bool) {
+			if !ok {
+				return
+			}
+			if githubCheck.Checked {
+				if err := requireToken(token); err != nil {
+					dialog.ShowError(err, w)
+					log.err(err.Error())
+					return
+				}
+			}
+			aliasConfig := hostConfig(alias)
+			plan, err := planAccountRemoval(sshDir, aliasConfig, label, alias, githubCheck.Checked)
+			if err != nil {
+				dialog.ShowError(err, w)
+				log.err(err.Error())
+				return
+			}
+
+			summary := widget.NewLabel(plan.summary())
+			summary.Wrapping = fyne.TextWrapWord
+			scroll := container.NewVScroll(summary)
+			scroll.SetMinSize(fyne.NewSize(520, 260))
+			dialog.ShowCustomConfirm("Confirm Removal", "Remove", "Cancel", scroll, func(ok bool) {
+				if !ok {
+					return
+				}
+				setStatus("Removing account")
+				archiveDir, err := executeAccountRemoval(plan, sshDir, aliasConfig, token, log.info)
+				tokenEntry.SetText("")
+				if err != nil {
+					dialog.ShowError(fmt.Errorf("account removal failed: %w", err), w)
+					log.err("Account removal failed: " + err.Error())
+					setStatus("Removal failed")
+					return
+				}
+				log.success("Account removed: " + label + " (" + alias + ")")
+				if plan.KeyPath != "" {
+					trackKey(func(reg keyRegistry) { delete(reg, label) })
+				}
+				setStatus("Account removed")
+				msg := "Account " + label + " removed."
+				if archiveDir != "" {
+					msg += "\nKey pair archived to: " + archiveDir
+				}
+				dialog.ShowInformation("Account Removed", msg, w)
+			}, w)
+		}, w)
+	})
+
+	backupBtn := widget.NewButtonWithIcon("Backup", theme.DownloadIcon(), func() {
+		keys, err := scanKeyInventory(sshDir, configFile)
+		if err != nil {
+			dialog.ShowError(err, w)
+			log.err("Could not scan SSH directory: " + err.Error())
+			return
+		}
+
+		var checks []*widget.Check
+		var paths []string
+		list := container.NewVBox()
+		for _, k := range keys {
+			if !k.HasPrivate {
+				continue
+			}
+			check := widget.NewCheck(filepath.Base(k.Path), nil)
+			check.SetChecked(true)
+			checks = append(checks, check)
+			paths = append(paths, k.Path)
+			list.Add(check)
+		}
+		if len(checks) == 0 {
+			dialog.ShowInformation("Backup", "No private keys found in "+sshDir, w)
+			return
+		}
+		scroll := container.NewVScroll(list)
+		scroll.SetMinSize(fyne.NewSize(0, 160))
+
+		passEntry := widget.NewPasswordEntry()
+		passConfirm := widget.NewPasswordEntry()
+		note := widget.NewLabel("Host entries and age records of the selected keys, GitHub known_hosts lines and the app settings are included.")
+		note.Wrapping = fyne.TextWrapWord
+		items := []*widget.FormItem{
+			widget.NewFormItem("Keys", scroll),
+			widget.NewFormItem("Passphrase", passEntry),
+			widget.NewFormItem("Confirm", passConfirm),
+			widget.NewFormItem("", note),
+		}
+		d := dialog.NewForm("Backup Keys", "Save", "Cancel", items, func(ok bool) {
+			if !ok {
+				return
+			}
+			if err := validatePassphrase(passEntry.Text, passConfirm.Text); err != nil {
+				dialog.ShowError(err, w)
+				log.err(err.Error())
+				return
+			}
+			var selected []string
+			for i, check := range checks {
+				if check.Checked {
+					selected = append(selected, paths[i])
+				}
+			}
+			settings := backupSettings{Naming: naming, IncludeMode: includeCheck.Checked, PreviewChanges: previewCheck.Checked}
+			bundle, err := collectBackup(sshDir, configFile, selected, settings)
+			if err != nil {
+				dialog.ShowError(err, w)
+				log.err("Backup failed: " + err.Error())
+				return
+			}
+			data, err := sealBackup(bundle, passEntry.Text)
+			if err != nil {
+				dialog.ShowError(err, w)
+				log.err("Backup failed: " + err.Error())
+				return
+			}
+			saveDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+				if err != nil {
+					dialog.ShowError(err, w)
+					return
+				}
+				if writer == nil {
+					return
+				}
+				defer writer.Close()
+				if _, err := writer.Write(data); err != nil {
+					dialog.ShowError(err, w)
+					log.err("Backup failed: " + err.Error())
+					return
+				}
+				if runtime.GOOS != "windows" {
+					_ = os.Chmod(writer.URI().Path(), 0o600)
+				}
+				log.success(fmt.Sprintf("Backed up %d key(s) and %d Host entries to %s", len(bundle.Keys), len(bundle.Hosts), writer.URI().Path()))
+				setStatus("Backup saved")
+			}, w)
+			saveDialog.SetFileName("github-ssh-" + time.Now().Format("20060102") + backupFileExt)
+			saveDialog.Show()
+		}, w)
+		d.Resize(fyne.NewSize(520, 420))
+		d.Show()
+	})
+
+	restoreBtn := widget.NewButtonWithIcon("Restore", theme.UploadIcon(), func() {
+		showRestorePlan := func(plan *restorePlan) {
+			list := container.NewVBox()
+			var overwrite []*widget.Check
+			var conflictIdx []int
+			for i, item := range plan.Items {
+				name := item.Kind + " " + item.Name
+				switch {
+				case item.Conflict:
+					check := widget.NewCheck("Overwrite existing "+name, nil)
+					overwrite = append(overwrite, check)
+					conflictIdx = append(conflictIdx, i)
+					list.Add(check)
+				case item.Same:
+					list.Add(widget.NewLabel(name + " (unchanged, skipped)"))
+				default:
+					list.Add(widget.NewLabel(name + " (new)"))
+				}
+			}
+			list.Add(widget.NewLabel(fmt.Sprintf("%d new GitHub known_hosts line(s)", len(plan.KnownHosts))))
+			settings := plan.bundle.Settings
+			settingsCheck := widget.NewCheck("Restore settings (naming templates, include mode, change preview)", nil)
+			if settings != nil {
+				list.Add(settingsCheck)
+			}
+			scroll := container.NewVScroll(list)
+			scroll.SetMinSize(fyne.NewSize(480, 240))
+
+			dialog.ShowCustomConfirm("Restore Backup", "Restore", "Cancel", scroll, func(ok bool) {
+				if !ok {
+					return
+				}
+				for i, check := range overwrite {
+					plan.Items[conflictIdx[i]].Overwrite = check.Checked
+				}
+				setStatus("Restoring backup")
+				if err := applyRestore(plan, sshDir, configFile, managedConfig(), log.info); err != nil {
+					dialog.ShowError(fmt.Errorf("restore failed: %w", err), w)
+					log.err("Restore failed: " + err.Error())
+					setStatus("Restore failed")
+					return
+				}
+				if settings != nil && settingsCheck.Checked {
+					if err := settings.Naming.validate(); err != nil {
+						log.warn("Backed up naming templates not restored: " + err.Error())
+					} else {
+						naming = settings.Naming
+						prefs.SetString("template.comment", naming.Comment)
+						prefs.SetString("template.filename", naming.FileName)
+						prefs.SetString("template.title", naming.Title)
+					}
+					includeCheck.SetChecked(settings.IncludeMode)
+					previewCheck.SetChecked(settings.PreviewChanges)
+					log.info("Settings restored from backup")
+				}
+				log.success("Backup restored into " + sshDir)
+				setStatus("Backup restored")
+			}, w)
+		}
+
+		openDialog := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+			if err != nil {
+				dialog.ShowError(err, w)
+				return
+			}
+			if reader == nil {
+				return
+			}
+			defer reader.Close()
+			data, err := io.ReadAll(reader)
+			if err != nil {
+				dialog.ShowError(err, w)
+				log.err("Cannot read backup file: " + err.Error())
+				return
+			}
+			showPassphrasePrompt(w, "Enter the passphrase for "+reader.URI().Path(), func(p string) {
+				bundle, err := openBackup(data, p)
+				if err != nil {
+					dialog.ShowError(err, w)
+					log.err("Cannot open backup: " + err.Error())
+					return
+				}
+				plan, err := planRestore(bundle, sshDir, configFile)
+				if err != nil {
+					dialog.ShowError(err, w)
+					log.err(err.Error())
+					return
+				}
+				showRestorePlan(plan)
+			})
+		}, w)
+		openDialog.Show()
+	})
+
+	keyAgeBtn := widget.NewButtonWithIcon("Key Ages", theme.HistoryIcon(), func() {
+		reg, err := loadKeyRegistry(sshDir)
+		if err != nil {
+			dialog.ShowError(err, w)
+			log.err(err.Error())
+			return
+		}
+		ages := reg.keyAges(time.Now())
+		if len(ages) == 0 {
+			dialog.ShowInformation("Key Ages", "No tracked keys yet. Keys are tracked when generated, imported or rotated.", w)
+			return
+		}
+
+		date := func(t time.Time, estimated bool) string {
+			if t.IsZero() {
+				return "-"
+			}
+			if estimated {
+				return "~" + t.Format("2006-01-02")
+			}
+			return t.Format("2006-01-02")
+		}
+		grid := container.NewGridWithColumns(6,
+			widget.NewLabelWithStyle("Account", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+			widget.NewLabelWithStyle("Created", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+			widget.NewLabelWithStyle("Uploaded", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+			widget.NewLabelWithStyle("Age", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+			widget.NewLabelWithStyle("Max Age (days)", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+			widget.NewLabelWithStyle("Status", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		)
+		maxEntries := map[string]*widget.Entry{}
+		for _, k := range ages {
+			maxEntry := widget.NewEntry()
+			maxEntry.SetText(strconv.Itoa(k.Record.maxAge()))
+			maxEntries[k.Label] = maxEntry
+			grid.Add(widget.NewLabel(k.Label))
+			grid.Add(widget.NewLabel(date(k.Record.Created, k.Record.Estimated)))
+			grid.Add(widget.NewLabel(date(k.Record.Uploaded, false)))
+			grid.Add(widget.NewLabel(fmt.Sprintf("%d days", k.AgeDays)))
+			grid.Add(maxEntry)
+			grid.Add(widget.NewLabel(k.state()))
+		}
+		note := widget.NewLabel("Dates marked ~ were estimated from the key file's modification time.")
+
+		d := dialog.NewCustomConfirm("Key Ages", "Save", "Close", container.NewBorder(nil, note, nil, nil, container.NewVScroll(grid)), func(ok bool) {
+			if !ok {
+				return
+			}
+			for label, entry := range maxEntries {
+				days, err := strconv.Atoi(strings.TrimSpace(entry.Text))
+				if err != nil || days <= 0 {
+					dialog.ShowError(fmt.Errorf("max age for %s must be a positive number of days", label), w)
+					log.err("Invalid max age for " + label)
+					return
+				}
+				if days == defaultMaxKeyAgeDays {
+					days = 0
+				}
+				reg[label].MaxAgeDays = days
+			}
+			if err := reg.save(sshDir); err != nil {
+				dialog.ShowError(err, w)
+				log.err("Could not save key age records: " + err.Error())
+				return
+			}
+			log.success("Key max ages saved")
+			checkKeyAges()
+		}, w)
+		d.Resize(fyne.NewSize(820, 420))
+		d.Show()
+	})
+
+	editHostBtn := widget.NewButtonWithIcon("Edit Host", theme.DocumentCreateIcon(), func() {
+		if err := ensureConfigFile(configFile); err != nil {
+			dialog.ShowError(err, w)
+			log.err("Could not prepare config file: " + err.Error())
+			return
+		}
+		files, err := configFiles(configFile)
+		if err != nil {
+			dialog.ShowError(err, w)
+			log.err(err.Error())
+			return
+		}
+		var aliases []string
+		aliasFile := map[string]string{}
+		contents := map[string][]byte{}
+		for _, f := range files {
+			data, err := os.ReadFile(f)
+			if err != nil {
+				continue
+			}
+			contents[f] = data
+			for _, b := range parseSSHConfig(data).Blocks {
+				if !b.Header.is("host") {
+					continue
+				}
+				for _, p := range b.Header.Args {
+					if _, dup := aliasFile[p]; !dup && !strings.ContainsAny(p, "*?!") {
+						aliases = append(aliases, p)
+						aliasFile[p] = f
+					}
+				}
+			}
+		}
+		if len(aliases) == 0 {
+			dialog.ShowInformation("Edit Host", "No Host entries found in "+configFile, w)
+			return
+		}
+
+		fields := map[string]*widget.Entry{}
+		var items []*widget.FormItem
+		aliasSelect := widget.NewSelect(aliases, nil)
+		items = append(items, widget.NewFormItem("Host", aliasSelect))
+		for _, name := range hostEditorFields {
+			entry := widget.NewEntry()
+			fields[name] = entry
+			items = append(items, widget.NewFormItem(name, entry))
+		}
+		extraEntry := widget.NewMultiLineEntry()
+		extraEntry.SetPlaceHolder("Other options, one per line, e.g. ServerAliveInterval 60")
+		extraEntry.SetMinRowsVisible(4)
+		items = append(items, widget.NewFormItem("Other Options", extraEntry))
+
+		aliasSelect.OnChanged = func(alias string) {
+			state, err := hostEditState(contents[aliasFile[alias]], alias)
+			if err != nil {
+				dialog.ShowError(err, w)
+				return
+			}
+			for name, entry := range fields {
+				entry.SetText(state.Fields[name])
+			}
+			extraEntry.SetText(strings.Join(state.Extra, "\n"))
+		}
+		selected := aliases[0]
+		for _, a := range aliases {
+			if strings.EqualFold(a, strings.TrimSpace(hostEntry.Text)) {
+				selected = a
+			}
+		}
+		aliasSelect.SetSelected(selected)
+
+		d := dialog.NewForm("Edit Host Entry", "Preview", "Cancel", items, func(ok bool) {
+			if !ok {
+				return
+			}
+			alias := aliasSelect.Selected
+			edit := hostEdit{Fields: map[string]string{}}
+			for name, entry := range fields {
+				edit.Fields[name] = strings.TrimSpace(entry.Text)
+			}
+			for _, line := range strings.Split(extraEntry.Text, "\n") {
+				if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+					edit.Extra = append(edit.Extra, line)
+				}
+			}
+			if err := validateHostEdit(edit, filepath.Dir(sshDir)); err != nil {
+				dialog.ShowError(err, w)
+				log.err(err.Error())
+				return
+			}
+			file := aliasFile[alias]
+			updated, err := applyHostEdit(contents[file], alias, edit)
+			if err != nil {
+				dialog.ShowError(err, w)
+				log.err(err.Error())
+				return
+			}
+			diff := unifiedDiff(file, string(contents[file]), string(updated))
+			if diff == "" {
+				dialog.ShowInformation("Edit Host", "No changes to save.", w)
+				return
+			}
+
+			diffText := widget.NewTextGridFromString(diff)
+			diffScroll := container.NewScroll(diffText)
+			diffScroll.SetMinSize(fyne.NewSize(640, 320))
+			dialog.ShowCustomConfirm("Review Changes", "Save", "Cancel", diffScroll, func(ok bool) {
+				if !ok {
+					return
+				}
+				if err := writeSSHFile(sshDir, file, updated, 0o600); err != nil {
+					dialog.ShowError(err, w)
+					log.err("Could not update SSH config: " + err.Error())
+					return
+				}
+				log.success("Host " + alias + " updated in " + file)
+				setStatus("Host entry updated")
+			}, w)
+		}, w)
+		d.Resize(fyne.NewSize(600, 560))
+		d.Show()
+	})
+
+	removeHostBtn := widget.NewButtonWithIcon("Remove Host", theme.ContentRemoveIcon(), func() {
+		alias := strings.TrimSpace(hostEntry.Text)
+		if err := validateHostAlias(alias); err != nil {
+			dialog.ShowError(err, w)
+			log.err(err.Error())
+			return
+		}
+		aliasConfig := hostConfig(alias)
+		config, err := os.ReadFile(aliasConfig)
 		if err != nil {
 			dialog.ShowError(err, w)
 			log.err(err.Error())
 			return
 		}
-
-		setStatus("Generating key pair")
-		keyPath, err := generateKeyPair(sshDir, label)
+		_, removed, err := removeHostAlias(config, alias)
 		if err != nil {
 			dialog.ShowError(err, w)
 			log.err(err.Error())
-			setStatus("Failed")
 			return
 		}
-		log.success("SSH key generated: " + keyPath)
 
-		if err := ensureGitHubKnownHost(sshDir); err != nil {
-			log.warn("Could not update known_hosts: " + err.Error())
-		} else {
-			log.success("github.com present in known_hosts")
-		}
+		preview := widget.NewTextGridFromString(strings.Trim(removed, "\r\n"))
+		previewScroll := container.NewScroll(preview)
+		previewScroll.SetMinSize(fyne.NewSize(520, 200))
+		body := container.NewBorder(widget.NewLabel("The following lines will be removed. The file is backed up first."), nil, nil, nil, previewScroll)
+		dialog.ShowCustomConfirm("Remove Host "+alias, "Remove", "Cancel", body, func(ok bool) {
+			if !ok {
+				return
+			}
+			backup, _, err := removeHostFromConfig(sshDir, aliasConfig, alias)
+			if err != nil {
+				dialog.ShowError(err, w)
+				log.err("Could not remove Host " + alias + ": " + err.Error())
+				return
+			}
+			log.info("SSH config backed up to " + backup)
+			log.success("Host " + alias + " removed from " + aliasConfig)
+			setStatus("Host entry removed")
+		}, w)
+	})
 
-		if err := ensureSSHConfigEntry(configFile, alias, keyPath); err != nil {
-			dialog.ShowError(err, w)
-			log.err("Failed to update SSH config: " + err.Error())
-			setStatus("Failed")
+	fileBackupsBtn := widget.NewButtonWithIcon("File Backups", theme.HistoryIcon(), func() {
+		var backups []fileBackup
+		for _, f := range backedUpFiles(sshDir, configFile) {
+			list, err := listFileBackups(sshDir, f)
+			if err != nil {
+				dialog.ShowError(err, w)
+				log.err(err.Error())
+				return
+			}
+			backups = append(backups, list...)
+		}
+		if len(backups) == 0 {
+			dialog.ShowInformation("Restore File Backup", "No backups yet. The SSH config and known_hosts are backed up to "+filepath.Join(sshDir, fileBackupDir)+" before each change.", w)
 			return
 		}
-		log.success("SSH config updated for host " + alias)
-		setStatus("Key generated and config updated")
-		dialog.ShowInformation("Success", "SSH key created and SSH config updated.", w)
+		sort.SliceStable(backups, func(i, j int) bool { return backups[i].Created.After(backups[j].Created) })
+
+		selected := -1
+		diffText := widget.NewTextGridFromString("Select a backup to see how restoring it would change the file.")
+		diffScroll := container.NewScroll(diffText)
+		list := widget.NewList(
+			func() int { return len(backups) },
+			func() fyne.CanvasObject { return widget.NewLabel("") },
+			func(id widget.ListItemID, obj fyne.CanvasObject) {
+				b := backups[id]
+				obj.(*widget.Label).SetText(fileBackupName(sshDir, b.Target) + "  " + b.Created.Format("2006-01-02 15:04:05"))
+			},
+		)
+		list.OnSelected = func(id widget.ListItemID) {
+			selected = id
+			b := backups[id]
+			saved, err := os.ReadFile(b.Path)
+			if err != nil {
+				diffText.SetText(err.Error())
+				return
+			}
+			current, err := os.ReadFile(b.Target)
+			if err != nil && !os.IsNotExist(err) {
+				diffText.SetText(err.Error())
+				return
+			}
+			diff := unifiedDiff(b.Target, string(current), string(saved))
+			if diff == "" {
+				diff = "Backup is identical to the current file."
+			}
+			diffText.SetText(diff)
+		}
+		split := container.NewHSplit(list, diffScroll)
+		split.Offset = 0.35
+
+		d := dialog.NewCustomConfirm("Restore File Backup", "Restore", "Close", split, func(ok bool) {
+			if !ok || selected < 0 {
+				return
+			}
+			b := backups[selected]
+			if err := restoreFileBackup(sshDir, b); err != nil {
+				dialog.ShowError(err, w)
+				log.err("Could not restore " + b.Target + ": " + err.Error())
+				return
+			}
+			log.success("Restored " + b.Target + " from backup of " + b.Created.Format("2006-01-02 15:04:05"))
+			setStatus("Backup restored")
+		}, w)
+		d.Resize(fyne.NewSize(1000, 520))
+		d.Show()
 	})
-	generateBtn.Importance = widget.HighImportance
 
-	showPublicBtn := widget.NewButtonWithIcon("Show Public Key", theme.VisibilityIcon(), func() {
-		label := strings.TrimSpace(labelEntry.Text)
-		if err := validateLabel(label); err != nil {
+	viewConfigBtn := widget.NewButtonWithIcon("View SSH Config", theme.DocumentIcon(), func() {
+		if err := ensureConfigFile(configFile); err != nil {
 			dialog.ShowError(err, w)
-			log.err(err.Error())
+			log.err("Could not prepare config file: " + err.Error())
 			return
 		}
-
-		pub, err := readPublicKey(sshDir, label)
+		cfg, err := osRead(configFile)
 		if err != nil {
 			dialog.ShowError(err, w)
 			log.err(err.Error())
 			return
 		}
+		if files, err := configFiles(configFile); err == nil {
+			for _, f := range files[1:] {
+				if included, err := osRead(f); err == nil {
+					cfg += "\n# ---- Included: " + f + " ----\n" + included
+				}
+			}
+		}
+		if strings.TrimSpace(cfg) == "" {
+			cfg = "# SSH config is empty\n"
+		}
 
-		pubText := widget.NewTextGridFromString(pub)
-		pubText.Scroll = fyne.ScrollBoth
-		pubScroll := container.NewScroll(pubText)
-		pubScroll.SetMinSize(fyne.NewSize(0, 220))
+		cfgText := widget.NewTextGridFromString(cfg)
+		cfgText.Scroll = fyne.ScrollBoth
+		cfgScroll := container.NewScroll(cfgText)
+		cfgScroll.SetMinSize(fyne.NewSize(0, 340))
 
-		copyBtn := widget.NewButtonWithIcon("Copy", theme.ContentCopyIcon(), func() {
-			a.Clipboard().SetContent(pub)
-			log.success("Public key copied to clipboard")
+		copyBtn := widget.NewButtonWithIcon("Copy Config", theme.ContentCopyIcon(), func() {
+			a.Clipboard().SetContent(cfg)
+			log.success("SSH config copied to clipboard")
 		})
-
 		body := container.NewBorder(
 			container.NewVBox(
-				widget.NewLabelWithStyle("Public key for "+label, fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
-				widget.NewLabel("Add this to GitHub -> SSH and GPG keys"),
+				widget.NewLabelWithStyle("SSH Config", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+				widget.NewLabel(configFile),
 				widget.NewSeparator(),
 			),
 			container.NewHBox(layout.NewSpacer(), copyBtn),
 			nil,
 			nil,
-			pubScroll,
+			cfgScroll,
 		)
-		d := dialog.NewCustom("Public Key", "Close", body, w)
-		d.Resize(fyne.NewSize(820, 420))
+		d := dialog.NewCustom("SSH Config", "Close", body, w)
+		d.Resize(fyne.NewSize(900, 520))
 		d.Show()
 	})
 
-	uploadBtn := widget.NewButtonWithIcon("Upload to GitHub", theme.UploadIcon(), func() {
-		label, alias, token, err := validateInputs(true)
-		if err != nil {
+	effectiveBtn := widget.NewButtonWithIcon("Effective Config", theme.ZoomInIcon(), func() {
+		alias := strings.TrimSpace(hostEntry.Text)
+		if err := validateHostAlias(alias); err != nil {
 			dialog.ShowError(err, w)
 			log.err(err.Error())
 			return
 		}
-
-		pub, err := readPublicKey(sshDir, label)
+		res, err := resolveHostConfig(configFile, alias, runMatchExec)
 		if err != nil {
-			dialog.ShowError(fmt.Errorf("generate key first: %w", err), w)
-			log.err("Public key not found for " + label)
+			dialog.ShowError(err, w)
+			log.err("Could not resolve SSH config: " + err.Error())
 			return
 		}
 
-		setStatus("Uploading key to GitHub")
-		resp, err := uploadKeyToGitHub(token, label+"-"+alias, pub)
-		if err != nil {
-			msg := err.Error()
-			if resp != nil && resp.Message != "" {
-				msg = resp.Message
+		// The raw view lists every block that applies to alias, each line
+		// prefixed with its line number. rowOf maps "file:line" to its row.
+		var raw []string
+		rowOf := map[string]int{}
+		addLine := func(file string, l *configLine) {
+			rowOf[fmt.Sprintf("%s:%d", file, l.Line)] = len(raw)
+			raw = append(raw, fmt.Sprintf("%5d  %s", l.Line, strings.TrimRight(l.raw, "\r\n")))
+		}
+		for _, tb := range res.Applied {
+			if tb.Block.Header == nil && tb.Block.lastOption() < 0 {
+				continue
 			}
-			dialog.ShowError(fmt.Errorf("GitHub upload failed: %s", msg), w)
-			log.err("GitHub upload failed: " + msg)
-			setStatus("Upload failed")
-			return
+			if len(raw) > 0 {
+				raw = append(raw, "")
+			}
+			raw = append(raw, "# "+tb.File)
+			if tb.Block.Header != nil {
+				addLine(tb.File, tb.Block.Header)
+			}
+			for _, l := range tb.Block.Lines[:tb.Block.lastOption()+1] {
+				addLine(tb.File, l)
+			}
+		}
+		rawGrid := widget.NewTextGridFromString(strings.Join(raw, "\n"))
+		sourceStyle := &widget.CustomTextGridStyle{BGColor: theme.Color(theme.ColorNameSelection)}
+		selectedStyle := &widget.CustomTextGridStyle{FGColor: theme.Color(theme.ColorNameForegroundOnPrimary), BGColor: theme.Color(theme.ColorNamePrimary)}
+		sourceRow := func(o resolvedOption) int {
+			if o.File == "" {
+				return -1
+			}
+			if row, ok := rowOf[fmt.Sprintf("%s:%d", o.File, o.Line)]; ok {
+				return row
+			}
+			return -1
+		}
+		for _, o := range res.Options {
+			rawGrid.SetRowStyle(sourceRow(o), sourceStyle)
+		}
+		rawGrid.Refresh()
+		rawScroll := container.NewScroll(rawGrid)
+
+		selectedRow := -1
+		list := widget.NewList(
+			func() int { return len(res.Options) },
+			func() fyne.CanvasObject { return widget.NewLabel("") },
+			func(id widget.ListItemID, obj fyne.CanvasObject) {
+				o := res.Options[id]
+				source := "default"
+				if o.File != "" {
+					source = fmt.Sprintf("%s:%d", filepath.Base(o.File), o.Line)
+				}
+				obj.(*widget.Label).SetText(o.Keyword + " " + o.Value + "    (" + source + ")")
+			},
+		)
+		list.OnSelected = func(id widget.ListItemID) {
+			if selectedRow >= 0 {
+				rawGrid.SetRowStyle(selectedRow, sourceStyle)
+			}
+			selectedRow = sourceRow(res.Options[id])
+			if selectedRow >= 0 {
+				rawGrid.SetRowStyle(selectedRow, selectedStyle)
+				rawScroll.Offset = rawGrid.PositionForCursorLocation(selectedRow, 0)
+				rawScroll.Refresh()
+			}
+			rawGrid.Refresh()
+		}
+
+		note := "Highlighted lines supply an effective value. Select an option to find its line."
+		for _, tb := range res.Skipped {
+			h := tb.Block.Header
+			if h == nil {
+				h = tb.Parent
+			}
+			note += fmt.Sprintf("\nNot evaluated: %s (%s line %d)", strings.TrimSpace(h.raw), tb.File, h.Line)
 		}
+		noteLabel := widget.NewLabel(note)
+		noteLabel.Wrapping = fyne.TextWrapWord
 
-		log.success(fmt.Sprintf("Key uploaded to GitHub (ID: %d)", resp.ID))
-		setStatus("Key uploaded")
-		tokenEntry.SetText("")
-		dialog.ShowInformation("Uploaded", fmt.Sprintf("Key uploaded successfully.\nTitle: %s\nID: %d", resp.Title, resp.ID), w)
+		split := container.NewHSplit(rawScroll, list)
+		split.Offset = 0.5
+		d := dialog.NewCustom("Effective Config for "+alias, "Close", container.NewBorder(nil, noteLabel, nil, nil, split), w)
+		d.Resize(fyne.NewSize(1000, 560))
+		d.Show()
+		log.info(fmt.Sprintf("Resolved %d effective option(s) for %s", len(res.Options), alias))
 	})
-	uploadBtn.Importance = widget.HighImportance
 
-	testBtn := widget.NewButtonWithIcon("Test SSH", theme.ConfirmIcon(), func() {
-		alias := strings.TrimSpace(hostEntry.Text)
-		if err := validateHostAlias(alias); err != nil {
+	inventoryBtn := widget.NewButtonWithIcon("Key Inventory", theme.ListIcon(), func() {
+		keys, err := scanKeyInventory(sshDir, configFile)
+		if err != nil {
 			dialog.ShowError(err, w)
-			log.err(err.Error())
+			log.err("Key inventory failed: " + err.Error())
 			return
 		}
+		log.info(fmt.Sprintf("Key inventory: %d keys found in %s", len(keys), sshDir))
 
-		setStatus("Testing SSH connection")
-		output, err := testSSHConnection(alias)
-		if err != nil {
-			log.err(output)
-			dialog.ShowError(fmt.Errorf("%s", output), w)
-			setStatus("SSH test failed")
-			return
+		headers := []string{"File", "Type", "Bits", "Encrypted", "Status", "Used By", "SHA256"}
+		cell := func(k inventoryKey, col int) string {
+			switch col {
+			case 0:
+				return filepath.Base(k.Path)
+			case 1:
+				if k.Type == "" {
+					return "unknown"
+				}
+				return k.Type
+			case 2:
+				if k.Bits == 0 {
+					return "-"
+				}
+				return strconv.Itoa(k.Bits)
+			case 3:
+				if !k.HasPrivate {
+					return "-"
+				}
+				if k.Encrypted {
+					return "yes"
+				}
+				return "no"
+			case 4:
+				return k.status()
+			case 5:
+				if len(k.Hosts) == 0 {
+					return "-"
+				}
+				return strings.Join(k.Hosts, ", ")
+			default:
+				return k.Fingerprint
+			}
+		}
+		table := widget.NewTable(
+			func() (int, int) { return len(keys) + 1, len(headers) },
+			func() fyne.CanvasObject { return widget.NewLabel("") },
+			func(id widget.TableCellID, obj fyne.CanvasObject) {
+				l := obj.(*widget.Label)
+				if id.Row == 0 {
+					l.TextStyle = fyne.TextStyle{Bold: true}
+					l.SetText(headers[id.Col])
+					return
+				}
+				l.TextStyle = fyne.TextStyle{}
+				l.SetText(cell(keys[id.Row-1], id.Col))
+			},
+		)
+		for col, width := range []float32{200, 170, 60, 90, 120, 200, 420} {
+			table.SetColumnWidth(col, width)
 		}
-		log.success("SSH connection verified for " + alias)
-		setStatus("SSH test passed")
-		dialog.ShowInformation("Connection OK", output, w)
-	})
 
-	viewConfigBtn := widget.NewButtonWithIcon("View SSH Config", theme.DocumentIcon(), func() {
-		if err := ensureConfigFile(configFile); err != nil {
-			dialog.ShowError(err, w)
-			log.err("Could not prepare config file: " + err.Error())
-			return
+		var orphaned, missing, unencrypted int
+		for _, k := range keys {
+			switch k.status() {
+			case "orphaned .pub":
+				orphaned++
+			case "missing .pub":
+				missing++
+			}
+			if k.HasPrivate && !k.Encrypted {
+				unencrypted++
+			}
 		}
-		cfg, err := osRead(configFile)
-		if err != nil {
-			dialog.ShowError(err, w)
-			log.err(err.Error())
-			return
+		summary := widget.NewLabel(fmt.Sprintf("%d keys, %d unencrypted, %d missing .pub, %d orphaned .pub", len(keys), unencrypted, missing, orphaned))
+
+		body := container.NewBorder(
+			container.NewVBox(
+				widget.NewLabelWithStyle("Keys in "+sshDir, fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+				summary,
+				widget.NewSeparator(),
+			),
+			nil, nil, nil,
+			table,
+		)
+		d := dialog.NewCustom("Key Inventory", "Close", body, w)
+		d.Resize(fyne.NewSize(960, 520))
+		d.Show()
+	})
+
+	auditBtn := widget.NewButtonWithIcon("Audit Keys", theme.WarningIcon(), func() {
+		var findings []auditFinding
+		rows := container.NewVBox()
+		summary := widget.NewLabel("")
+
+		var d dialog.Dialog
+		var refresh func()
+
+		addPassphrase := func(keyPath string) {
+			data, err := os.ReadFile(keyPath)
+			if err != nil {
+				dialog.ShowError(err, w)
+				log.err(err.Error())
+				return
+			}
+			key, err := parsePrivateKeyData(data, "")
+			if err != nil {
+				dialog.ShowError(err, w)
+				log.err(err.Error())
+				return
+			}
+			comment := filepath.Base(keyPath)
+			if pub, err := os.ReadFile(keyPath + ".pub"); err == nil {
+				if fields := strings.Fields(string(pub)); len(fields) > 2 {
+					comment = strings.Join(fields[2:], " ")
+				}
+			}
+
+			showPassphraseForm("Add Passphrase", key, comment, keyPath, "", false, refresh)
 		}
-		if strings.TrimSpace(cfg) == "" {
-			cfg = "# SSH config is empty\n"
+
+		remediate := func(f auditFinding) {
+			switch f.Remedy {
+			case remedyPermissions:
+				if err := fixKeyPermissions(f.Path); err != nil {
+					dialog.ShowError(err, w)
+					log.err("Could not fix permissions: " + err.Error())
+					return
+				}
+				log.success("Permissions of " + f.Path + " set to 0600")
+				refresh()
+			case remedyPassphrase:
+				addPassphrase(f.Path)
+			case remedyRotate:
+				labelEntry.SetText(f.Label)
+				if aliases := refAliases(f.Hosts); len(aliases) > 0 {
+					hostEntry.SetText(aliases[0])
+				}
+				d.Hide()
+				log.info("Fill in the GitHub token and choose an algorithm, then press Rotate Key to replace " + f.Path)
+				setStatus("Ready to rotate " + filepath.Base(f.Path))
+			}
 		}
 
-		cfgText := widget.NewTextGridFromString(cfg)
-		cfgText.Scroll = fyne.ScrollBoth
-		cfgScroll := container.NewScroll(cfgText)
-		cfgScroll.SetMinSize(fyne.NewSize(0, 340))
+		refresh = func() {
+			var err error
+			findings, err = auditKeys(sshDir, configFile)
+			if err != nil {
+				dialog.ShowError(err, w)
+				log.err("Key audit failed: " + err.Error())
+				return
+			}
+			summary.SetText(auditSummary(findings))
+			rows.RemoveAll()
+			if len(findings) == 0 {
+				rows.Add(widget.NewLabel("No weak or risky keys found."))
+			}
+			for _, f := range findings {
+				severity := widget.NewLabelWithStyle(strings.ToUpper(f.Severity), fyne.TextAlignLeading, fyne.TextStyle{Bold: f.Severity == severityHigh})
+				issue := widget.NewLabel(filepath.Base(f.Path) + ": " + f.Issue)
+				issue.Wrapping = fyne.TextWrapWord
+				action := widget.NewButton(f.Remedy, func() { remediate(f) })
+				if f.Remedy == remedyManual {
+					// No account label leads back to this key, so it has
+					// to be replaced by hand.
+					action.Disable()
+				}
+				rows.Add(container.NewBorder(nil, nil, severity, action, issue))
+			}
+		}
+		refresh()
+		log.info("Key audit: " + summary.Text)
 
-		copyBtn := widget.NewButtonWithIcon("Copy Config", theme.ContentCopyIcon(), func() {
-			a.Clipboard().SetContent(cfg)
-			log.success("SSH config copied to clipboard")
+		exportBtn := widget.NewButtonWithIcon("Export CSV", theme.DocumentSaveIcon(), func() {
+			data, err := auditReportCSV(findings)
+			if err != nil {
+				dialog.ShowError(err, w)
+				log.err(err.Error())
+				return
+			}
+			saveDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+				if err != nil {
+					dialog.ShowError(err, w)
+					return
+				}
+				if writer == nil {
+					return
+				}
+				defer writer.Close()
+				if _, err := writer.Write(data); err != nil {
+					dialog.ShowError(err, w)
+					log.err("Audit export failed: " + err.Error())
+					return
+				}
+				log.success("Audit report saved: " + writer.URI().Path())
+			}, w)
+			saveDialog.SetFileName("ssh-key-audit-" + time.Now().Format("20060102") + ".csv")
+			saveDialog.Show()
 		})
+
 		body := container.NewBorder(
 			container.NewVBox(
-				widget.NewLabelWithStyle("SSH Config", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
-				widget.NewLabel(configFile),
+				widget.NewLabelWithStyle("Audit of "+sshDir, fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+				summary,
 				widget.NewSeparator(),
 			),
-			container.NewHBox(layout.NewSpacer(), copyBtn),
-			nil,
-			nil,
-			cfgScroll,
+			container.NewHBox(layout.NewSpacer(), exportBtn),
+			nil, nil,
+			container.NewVScroll(rows),
 		)
-		d := dialog.NewCustom("SSH Config", "Close", body, w)
+		d = dialog.NewCustom("Key Audit", "Close", body, w)
+		d.Resize(fyne.NewSize(860, 520))
+		d.Show()
+	})
+
+	lintBtn := widget.NewButtonWithIcon("Lint Config", theme.SearchIcon(), func() {
+		rows := container.NewVBox()
+		summary := widget.NewLabel("")
+
+		var refresh func()
+		fix := func(f lintFinding) {
+			before, err := os.ReadFile(f.File)
+			if err != nil {
+				dialog.ShowError(err, w)
+				log.err(err.Error())
+				return
+			}
+			after, err := applyLintFix(before, f)
+			if err != nil {
+				dialog.ShowError(err, w)
+				log.err(err.Error())
+				return
+			}
+			changes := []fileChange{{Path: f.File, Before: before, After: after, Perm: 0o600}}
+			confirmFileChanges(changes, func() {
+				if err := applyFileChanges(sshDir, changes); err != nil {
+					dialog.ShowError(err, w)
+					log.err("Could not apply fix: " + err.Error())
+					return
+				}
+				log.success(fmt.Sprintf("%s applied at %s:%d", f.Fix, f.File, f.Line))
+				refresh()
+			})
+		}
+
+		refresh = func() {
+			findings, err := lintSSHConfig(configFile)
+			if err != nil {
+				dialog.ShowError(err, w)
+				log.err("SSH config lint failed: " + err.Error())
+				return
+			}
+			summary.SetText(lintSummary(findings))
+			rows.RemoveAll()
+			if len(findings) == 0 {
+				rows.Add(widget.NewLabel("No problems found."))
+			}
+			for _, f := range findings {
+				severity := widget.NewLabelWithStyle(strings.ToUpper(f.Severity), fyne.TextAlignLeading, fyne.TextStyle{Bold: f.Severity == severityHigh})
+				issue := widget.NewLabel(fmt.Sprintf("%s:%d: %s", f.File, f.Line, f.Issue))
+				issue.Wrapping = fyne.TextWrapWord
+				var action fyne.CanvasObject
+				if f.Fix != "" {
+					action = widget.NewButton(f.Fix, func() { fix(f) })
+				}
+				rows.Add(container.NewBorder(nil, nil, severity, action, issue))
+			}
+		}
+		refresh()
+		log.info("SSH config lint: " + summary.Text)
+
+		body := container.NewBorder(
+			container.NewVBox(
+				widget.NewLabelWithStyle("Lint of "+configFile+" and included files", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+				summary,
+				widget.NewSeparator(),
+			),
+			nil, nil, nil,
+			container.NewVScroll(rows),
+		)
+		d := dialog.NewCustom("SSH Config Lint", "Close", body, w)
 		d.Resize(fyne.NewSize(900, 520))
 		d.Show()
 	})
 
+	templatesBtn := widget.NewButtonWithIcon("Naming", theme.SettingsIcon(), func() {
+		commentEntry := widget.NewEntry()
+		commentEntry.SetText(naming.Comment)
+		fileNameEntry := widget.NewEntry()
+		fileNameEntry.SetText(naming.FileName)
+		titleEntry := widget.NewEntry()
+		titleEntry.SetText(naming.Title)
+
+		preview := widget.NewLabel("")
+		preview.Wrapping = fyne.TextWrapWord
+		updatePreview := func(string) {
+			n := keyNaming{Comment: commentEntry.Text, FileName: fileNameEntry.Text, Title: titleEntry.Text}
+			if err := n.validate(); err != nil {
+				preview.SetText(err.Error())
+				return
+			}
+			label := strings.TrimSpace(labelEntry.Text)
+			if label == "" {
+				label = "work"
+			}
+			alias := strings.TrimSpace(hostEntry.Text)
+			if alias == "" {
+				alias = "github-work"
+			}
+			v := newTemplateVars(label, alias, lookupKeyAlgorithm(algorithmSelect.Selected))
+			preview.SetText(fmt.Sprintf("File: %s\nComment: %s\nGitHub title: %s", n.fileName(v), n.comment(v), n.title(v)))
+		}
+		commentEntry.OnChanged = updatePreview
+		fileNameEntry.OnChanged = updatePreview
+		titleEntry.OnChanged = updatePreview
+		updatePreview("")
+
+		resetBtn := widget.NewButton("Reset to defaults", func() {
+			commentEntry.SetText(defaultKeyNaming.Comment)
+			fileNameEntry.SetText(defaultKeyNaming.FileName)
+			titleEntry.SetText(defaultKeyNaming.Title)
+		})
+		help := widget.NewLabel("Placeholders: " + strings.Join(templatePlaceholders, " "))
+		help.Wrapping = fyne.TextWrapWord
+
+		items := []*widget.FormItem{
+			widget.NewFormItem("Key Comment", commentEntry),
+			widget.NewFormItem("File Name", fileNameEntry),
+			widget.NewFormItem("GitHub Title", titleEntry),
+			widget.NewFormItem("", help),
+			widget.NewFormItem("Preview", preview),
+			widget.NewFormItem("", resetBtn),
+		}
+		d := dialog.NewForm("Naming Templates", "Save", "Cancel", items, func(ok bool) {
+			if !ok {
+				return
+			}
+			n := keyNaming{Comment: commentEntry.Text, FileName: fileNameEntry.Text, Title: titleEntry.Text}
+			if err := n.validate(); err != nil {
+				dialog.ShowError(err, w)
+				log.err(err.Error())
+				return
+			}
+			naming = n
+			prefs.SetString("template.comment", n.Comment)
+			prefs.SetString("template.filename", n.FileName)
+			prefs.SetString("template.title", n.Title)
+			log.success("Naming templates saved")
+		}, w)
+		d.Resize(fyne.NewSize(560, 420))
+		d.Show()
+	})
+
 	helpBtn := widget.NewButtonWithIcon("Instructions", theme.HelpIcon(), func() {
 		bullet := func(icon fyne.Resource, title, details string) fyne.CanvasObject {
 			titleLabel := widget.NewLabelWithStyle(title, fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
@@ -265,9 +1931,11 @@ func buildUI(a fyne.App, w fyne.Window, sshDir string) {
 		fieldGuide := widget.NewCard("Field Guide", "", container.NewVBox(
 			bullet(theme.InfoIcon(), "Label", "Friendly key name such as work, personal, or company."),
 			bullet(theme.HelpIcon(), "Host Alias", "A unique SSH host alias per account, for example github-work or github-personal."),
+			bullet(theme.SearchIcon(), "Match Rule", "Optional. Writes the entry as a Match block that only applies while the criteria hold, for example exec \"ping -c1 -W1 intranet.example.com\" for a per-network rule. Supported criteria: host, originalhost, user, localuser, exec."),
+			bullet(theme.ConfirmIcon(), "Port 443", "For networks that block port 22. New entries use HostName ssh.github.com and Port 443, and [ssh.github.com]:443 is added to known_hosts. Test SSH offers to switch an alias when port 22 times out."),
 		))
 
-		configPreview := widget.NewRichTextFromMarkdown("```sshconfig\nHost github-work\n  HostName github.com\n  User git\n  IdentityFile ~/.ssh/<label>-<alias>\n  AddKeysToAgent yes\n  IdentitiesOnly yes\n```")
+		configPreview := widget.NewRichTextFromMarkdown("```sshconfig\nHost github-work\n  HostName github.com\n  User git\n  IdentityFile ~/.ssh/id_<algorithm>_<label>\n  AddKeysToAgent yes\n  IdentitiesOnly yes\n```")
 		usagePreview := widget.NewRichTextFromMarkdown("Use in git remote: `git@github-work:org/repo.git`")
 		hostAlias := widget.NewCard("Host Alias Details", "", container.NewVBox(
 			bullet(theme.VisibilityIcon(), "Alias Rules", "Use 1-128 characters with letters, numbers, '.', '-', '_'. Do not use github.com."),
@@ -279,6 +1947,7 @@ func buildUI(a fyne.App, w fyne.Window, sshDir string) {
 		security := widget.NewCard("Token & Security", "", container.NewVBox(
 			bullet(theme.InfoIcon(), "Token handling", "Token is used only for a direct HTTPS API call and then cleared after upload."),
 			bullet(theme.ConfirmIcon(), "Local files", "Keys and SSH config remain local in ~/.ssh."),
+			bullet(theme.WarningIcon(), "Passphrases", "Private keys are encrypted with your passphrase using the bcrypt KDF. Creating a key without one is an explicit opt-out and is logged."),
 		))
 
 		linkURL, _ := url.Parse("https://github.com/settings/tokens")
@@ -340,6 +2009,8 @@ func buildUI(a fyne.App, w fyne.Window, sshDir string) {
 	})
 
 	actions := container.NewGridWithColumns(2, generateBtn, uploadBtn, showPublicBtn, testBtn)
+	keyActions := container.NewGridWithColumns(2, importBtn, exportBtn, changePassBtn, rotateBtn)
+	accountActions := container.NewGridWithColumns(2, backupBtn, restoreBtn, keyAgeBtn, removeBtn)
 
 	inputCard := widget.NewCard(
 		"Account Setup",
@@ -347,7 +2018,18 @@ func buildUI(a fyne.App, w fyne.Window, sshDir string) {
 		container.New(layout.NewFormLayout(),
 			widget.NewLabel("Label"), labelEntry,
 			widget.NewLabel("Host Alias"), hostEntry,
+			widget.NewLabel("Match Rule"), matchEntry,
+			layout.NewSpacer(), port443Check,
 			widget.NewLabel("GitHub Token"), tokenEntry,
+			widget.NewLabel("Algorithm"), algorithmSelect,
+			widget.NewLabel("Key Backend"), backendSelect,
+			widget.NewLabel("Passphrase"), passphraseEntry,
+			widget.NewLabel("Confirm"), confirmEntry,
+			widget.NewLabel("Strength"), strengthBar,
+			widget.NewLabel("KDF Rounds"), roundsEntry,
+			layout.NewSpacer(), noPassphraseCheck,
+			widget.NewLabel("SSH Config"), includeCheck,
+			layout.NewSpacer(), previewCheck,
 			widget.NewLabel("Theme"), themeSelect,
 		),
 	)
@@ -355,7 +2037,7 @@ func buildUI(a fyne.App, w fyne.Window, sshDir string) {
 	actionsCard := widget.NewCard(
 		"Actions",
 		"Recommended flow: Generate -> Upload -> Test",
-		container.NewVBox(actions, container.NewGridWithColumns(2, viewConfigBtn, helpBtn)),
+		container.NewVBox(actions, keyActions, accountActions, container.NewGridWithColumns(4, viewConfigBtn, editHostBtn, removeHostBtn, effectiveBtn, fileBackupsBtn, inventoryBtn, auditBtn, lintBtn, templatesBtn, helpBtn)),
 	)
 
 	logScroll := container.NewVScroll(logContainer)
@@ -382,6 +2064,25 @@ func buildUI(a fyne.App, w fyne.Window, sshDir string) {
 	w.SetIcon(theme.ComputerIcon())
 }
 
+// showPassphrasePrompt asks for a key passphrase and calls onSubmit with it
+// unless the user cancels.
+func showPassphrasePrompt(w fyne.Window, message string, onSubmit func(passphrase string)) {
+	entry := widget.NewPasswordEntry()
+	label := widget.NewLabel(message)
+	label.Wrapping = fyne.TextWrapWord
+	items := []*widget.FormItem{
+		widget.NewFormItem("", label),
+		widget.NewFormItem("Passphrase", entry),
+	}
+	d := dialog.NewForm("Passphrase Required", "Unlock", "Cancel", items, func(ok bool) {
+		if ok {
+			onSubmit(entry.Text)
+		}
+	}, w)
+	d.Resize(fyne.NewSize(480, 200))
+	d.Show()
+}
+
 func osRead(path string) (string, error) {
 	b, err := os.ReadFile(path)
 	if err != nil {
@@ -2,8 +2,12 @@ package main
 
 import (
 	"fmt"
+	"math"
 	"regexp"
+	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 var (
@@ -34,3 +38,82 @@ func requireToken(token string) error {
 	}
 	return nil
 }
+
+const minPassphraseLength = 8
+
+func validatePassphrase(passphrase, confirm string) error {
+	if len(passphrase) < minPassphraseLength {
+		return fmt.Errorf("passphrase must be at least %d characters", minPassphraseLength)
+	}
+	if passphrase != confirm {
+		return fmt.Errorf("passphrase and confirmation do not match")
+	}
+	return nil
+}
+
+func validateKDFRounds(rounds int) error {
+	if rounds < 1 || rounds > maxKDFRounds {
+		return fmt.Errorf("KDF rounds must be between 1 and %d", maxKDFRounds)
+	}
+	return nil
+}
+
+func parseKDFRounds(text string) (int, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return defaultKDFRounds, nil
+	}
+	rounds, err := strconv.Atoi(text)
+	if err != nil {
+		return 0, fmt.Errorf("KDF rounds must be a number")
+	}
+	return rounds, validateKDFRounds(rounds)
+}
+
+// passphraseStrength estimates the entropy of a passphrase from its length
+// and character classes and maps it onto a 0-4 score with a display label.
+func passphraseStrength(passphrase string) (int, string) {
+	if passphrase == "" {
+		return 0, "None"
+	}
+	var lower, upper, digit, symbol bool
+	for _, r := range passphrase {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	pool := 0
+	if lower {
+		pool += 26
+	}
+	if upper {
+		pool += 26
+	}
+	if digit {
+		pool += 10
+	}
+	if symbol {
+		pool += 33
+	}
+	bits := float64(utf8.RuneCountInString(passphrase)) * math.Log2(float64(pool))
+
+	switch {
+	case bits < 28:
+		return 0, "Very weak"
+	case bits < 40:
+		return 1, "Weak"
+	case bits < 60:
+		return 2, "Fair"
+	case bits < 80:
+		return 3, "Strong"
+	default:
+		return 4, "Very strong"
+	}
+}